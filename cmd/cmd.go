@@ -2,8 +2,10 @@ package cmd
 
 import (
 	logging "github.com/ipfs/go-log"
+	"go-blog/services"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"os"
+	"strings"
 )
 
 type cmdMap map[string]func() error
@@ -18,23 +20,86 @@ func Run() error {
 	initHost := initCmd.Flag("host", "The host of router. It would be 127.0.0.1 by default.").Default("127.0.0.1").String()
 	initPort := initCmd.Flag("port", "The port running web.").Default("8080").Uint16()
 	initOverwrite := initCmd.Flag("overwrite", "").Bool()
+	initNotes := initCmd.Flag("notes", "The notes root directory. It would be notes in repo directory by default.").String()
+	initControl := initCmd.Flag("control", "The unix socket commands are sent through. Commands use loopback address if not set.").String()
 	cmds[initCmd.FullCommand()] = func() error {
-		return cmdInit(*initHost, *initPort, *initOverwrite)
+		return cmdInit(*initHost, *initPort, *initOverwrite, *initNotes, *initControl)
 	}
 
 	startCmd := appCmd.Command("start", "Start the server.")
+	startDev := startCmd.Flag("dev", "Reload templates when they are changed.").Bool()
 	cmds[startCmd.FullCommand()] = func () error {
-		return cmdStart()
+		return cmdStart(*startDev)
 	}
 
 	mdCmd := appCmd.Command("markdown", "Markdown related command. Mainly for debug.")
 	mdRenderCmd := mdCmd.Command("render", "Render markdown to html.")
 	mdRenderInput := mdRenderCmd.Arg("input", "The input file path.").Required().String()
-	mdRenderOutput := mdRenderCmd.Arg("output", "The output file path. It would be input.html by default.").String()
+	mdRenderOutput := mdRenderCmd.Arg("output", "The output file path. It would be input.html by default. "+
+		"With --remote, it is where input is uploaded in notes root if input is outside of notes root.").String()
+	mdRenderRemote := mdRenderCmd.Flag("remote", "Render through the running server so that its notes are updated.").Bool()
 	cmds[mdRenderCmd.FullCommand()] = func() error {
+		if *mdRenderRemote {
+			return cmdMdRenderRemote(*mdRenderInput, *mdRenderOutput)
+		}
 		return cmdMdRender(*mdRenderInput, *mdRenderOutput)
 	}
 
+	searchCmd := appCmd.Command("search", "Search notes with the index written by server.")
+	searchQuery := searchCmd.Arg("query", "Words to search.").Required().Strings()
+	searchLimit := searchCmd.Flag("limit", "The max number of results.").Default("10").Int()
+	cmds[searchCmd.FullCommand()] = func() error {
+		return cmdSearch(strings.Join(*searchQuery, " "), *searchLimit)
+	}
+
+	themeCmd := appCmd.Command("theme", "Manage themes, which override resources such as templates and css.")
+	themeListCmd := themeCmd.Command("list", "List themes. The one in use is marked with *.")
+	cmds[themeListCmd.FullCommand()] = func() error {
+		return cmdThemeList()
+	}
+	themeInstallCmd := themeCmd.Command("install", "Install a theme directory laid out like the resource directory.")
+	themeInstallSrc := themeInstallCmd.Arg("dir", "The theme directory.").Required().String()
+	themeInstallName := themeInstallCmd.Flag("name", "The name of theme. It would be the name of directory by default.").String()
+	themeInstallOverwrite := themeInstallCmd.Flag("overwrite", "Replace the installed theme with the same name.").Bool()
+	cmds[themeInstallCmd.FullCommand()] = func() error {
+		return cmdThemeInstall(*themeInstallSrc, *themeInstallName, *themeInstallOverwrite)
+	}
+	themeUseCmd := themeCmd.Command("use", "Use a theme. Use \"default\" for resource directory only.")
+	themeUseName := themeUseCmd.Arg("name", "The name of theme.").Required().String()
+	cmds[themeUseCmd.FullCommand()] = func() error {
+		return cmdThemeUse(*themeUseName)
+	}
+
+	userCmd := appCmd.Command("user", "Manage users who can login. Roles are admin, editor and reader.")
+	userAddCmd := userCmd.Command("add", "Add a user. Password is read from terminal, or stdin if it is not a terminal.")
+	userAddName := userAddCmd.Arg("name", "The name of user.").Required().String()
+	userAddRole := userAddCmd.Flag("role", "The role of user.").Default(services.RoleReader).Enum(
+		services.RoleAdmin, services.RoleEditor, services.RoleReader)
+	cmds[userAddCmd.FullCommand()] = func() error {
+		return cmdUserAdd(*userAddName, *userAddRole)
+	}
+	userPasswdCmd := userCmd.Command("passwd", "Change the password of user. Sessions of the user would end.")
+	userPasswdName := userPasswdCmd.Arg("name", "The name of user.").Required().String()
+	cmds[userPasswdCmd.FullCommand()] = func() error {
+		return cmdUserPasswd(*userPasswdName)
+	}
+	userRoleCmd := userCmd.Command("role", "Change the role of user.")
+	userRoleName := userRoleCmd.Arg("name", "The name of user.").Required().String()
+	userRoleRole := userRoleCmd.Arg("role", "The new role.").Required().Enum(
+		services.RoleAdmin, services.RoleEditor, services.RoleReader)
+	cmds[userRoleCmd.FullCommand()] = func() error {
+		return cmdUserRole(*userRoleName, *userRoleRole)
+	}
+	userRemoveCmd := userCmd.Command("remove", "Remove a user.")
+	userRemoveName := userRemoveCmd.Arg("name", "The name of user.").Required().String()
+	cmds[userRemoveCmd.FullCommand()] = func() error {
+		return cmdUserRemove(*userRemoveName)
+	}
+	userListCmd := userCmd.Command("list", "List users.")
+	cmds[userListCmd.FullCommand()] = func() error {
+		return cmdUserList()
+	}
+
 	cmd := kingpin.MustParse(appCmd.Parse(os.Args[1:]))
 	for key, value := range cmds {
 		if key == cmd {
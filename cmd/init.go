@@ -3,10 +3,13 @@ package cmd
 import (
 	"go-blog/common"
 	"go-blog/config"
+	"go-blog/resources"
+	"go-blog/themes"
 	"os"
+	"path/filepath"
 )
 
-func cmdInit(initHost string, initPort uint16, overWrite bool) error {
+func cmdInit(initHost string, initPort uint16, overWrite bool, notesDir string, control string) error {
 	// Init repo dir
 	var err error
 	dir := common.PathCfgDir()
@@ -37,16 +40,47 @@ func cmdInit(initHost string, initPort uint16, overWrite bool) error {
 	}
 
 	// Init resource dir
-	err = common.CopyDir("resources", common.PathResDir())
+	err = common.ExtractFS(resources.FS, ".", common.PathResDir())
+	if err != nil {
+		return err
+	}
+
+	// Install bundled themes
+	err = common.ExtractFS(themes.FS, ".", common.PathThemeDir())
 	if err != nil {
 		return err
 	}
 
 	cfg := config.NewFileConfig()
 	cfg.Reset(initHost, initPort)
+	if notesDir != "" {
+		notesDir, err = filepath.Abs(notesDir)
+		if err != nil {
+			return err
+		}
+		cfg.SetNoteDir(notesDir)
+	}
+
+	if control != "" {
+		control, err = filepath.Abs(control)
+		if err != nil {
+			return err
+		}
+		cfg.SetControlSocket(control)
+	}
+
+	// Init notes dir
+	err = os.MkdirAll(cfg.NoteDir(), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
 	err = cfg.WriteBack()
 	if err != nil {
 		return err
 	}
-	return nil
+
+	// Commands sent to server are authorized by admin token.
+	_, err = common.NewAdminToken(common.PathAdminToken())
+	return err
 }
@@ -2,10 +2,22 @@ package cmd
 
 import (
 	"go-blog/common"
+	"go-blog/config"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 func cmdMdRender(input string, output string) error {
+	// Render as the server does if there is a repo, otherwise with default options.
+	if common.FileExist(common.PathCfgFile()) {
+		cfg, err := config.OpenFileConfig()
+		if err != nil {
+			return err
+		}
+		common.SetMdRenderer(common.NewMdRenderer(cfg.Markdown()))
+	}
 	info, err := os.Stat(input)
 	if err != nil {
 		return err
@@ -16,3 +28,34 @@ func cmdMdRender(input string, output string) error {
 		return common.MdRenderFile(input, output)
 	}
 }
+
+// cmdMdRenderRemote ask the running server to render input, so that its notes and cache are updated.
+// input inside notes root would be rendered in place.
+// Otherwise it would be uploaded to output in notes root, which is the name of input by default.
+func cmdMdRenderRemote(input string, output string) error {
+	cfg, err := config.OpenFileConfig()
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(input)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	rel, err := filepath.Rel(cfg.NoteDir(), abs)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		values["path"] = abs
+	} else {
+		content, err := ioutil.ReadFile(abs)
+		if err != nil {
+			return err
+		}
+		if output == "" {
+			output = filepath.Base(abs)
+		}
+		values["path"] = output
+		values["content"] = string(content)
+	}
+	return sendRequest("/cmd/markdown/render", values, cfg, jsonPrinter)
+}
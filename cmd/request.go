@@ -2,10 +2,15 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-blog/common"
+	"go-blog/config"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -39,8 +44,28 @@ func jsonPrinter(reader io.Reader) error {
 	return nil
 }
 
-func sendRequest(path string, values map[string]string, port int, output printer) error{
-	apiUrl := fmt.Sprintf("http://127.0.0.1:%d", port)
+// sendRequest post values to path of the running server with admin token.
+// The request is sent through control socket if it is configured and exists,
+// otherwise to the loopback address.
+func sendRequest(path string, values map[string]string, cfg config.Config, output printer) error {
+	token, err := common.ReadAdminToken(common.PathAdminToken())
+	if err != nil {
+		log.Error("Error when read admin token: ", err)
+		return err
+	}
+
+	client := &http.Client{}
+	apiUrl := fmt.Sprintf("http://127.0.0.1:%d", cfg.Port())
+	if sock := cfg.ControlSocket(); sock != "" && common.PathExists(sock) {
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", sock)
+			},
+		}
+		// Host is ignored when dialing the socket.
+		apiUrl = "http://control"
+	}
 
 	data := url.Values{}
 	if values != nil {
@@ -54,9 +79,9 @@ func sendRequest(path string, values map[string]string, port int, output printer
 
 	urlStr := u.String()
 
-	client := &http.Client{}
 	r, _ := http.NewRequest("POST", urlStr, strings.NewReader(data.Encode()))
 	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Add("Authorization", "Bearer "+token)
 
 	resp, err := client.Do(r)
 	if err != nil {
@@ -66,9 +91,17 @@ func sendRequest(path string, values map[string]string, port int, output printer
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.New("request refused by server: " + strings.TrimSpace(string(msg)))
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
 	err = output(resp.Body)
 	if err != nil {
 		log.Error("Error when read response from server: ", err)
 	}
-	return nil
+	return err
 }
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+	"go-blog/common"
+	"go-blog/services"
+)
+
+// cmdSearch search notes with the index written by server.
+func cmdSearch(query string, limit int) error {
+	idx, err := services.OpenSearchIndex(common.PathSearchIndex())
+	if err != nil {
+		return err
+	}
+	results := idx.Search(query, limit)
+	if len(results) == 0 {
+		fmt.Println("No note found.")
+		return nil
+	}
+	for _, res := range results {
+		fmt.Printf("%s (%s) %.3f\n", res.Title, res.Path, res.Score)
+		fmt.Println("\t" + termHighlight(res.Snippet, res.Matches))
+	}
+	return nil
+}
+
+// termHighlight make matches in snippet bold on terminal.
+func termHighlight(snippet string, matches [][2]int) string {
+	res := ""
+	last := 0
+	for _, m := range matches {
+		res += snippet[last:m[0]] + "\033[1m" + snippet[m[0]:m[1]] + "\033[0m"
+		last = m[1]
+	}
+	return res + snippet[last:]
+}
@@ -5,7 +5,9 @@ import (
 	"go-blog/server"
 )
 
-func cmdStart() error {
+// cmdStart start the server. Templates would be reloaded when changed if dev is true,
+// no matter what is in config.
+func cmdStart(dev bool) error {
 	var err error
 	defer func(){
 		log.Error("Error when start server: ", err)
@@ -15,6 +17,9 @@ func cmdStart() error {
 	if err != nil {
 		return err
 	}
+	if dev {
+		cfg.SetDevMode(true)
+	}
 	ser := server.NewGinServer(cfg)
 	go ser.Start()
 	return ser.Run()
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"go-blog/common"
+	"go-blog/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cmdThemeList print the default theme and themes installed, with the one in use marked.
+func cmdThemeList() error {
+	cfg, err := config.OpenFileConfig()
+	if err != nil {
+		return err
+	}
+	themes, err := installedThemes()
+	if err != nil {
+		return err
+	}
+	for _, name := range append([]string{common.DEFAULT_THEME}, themes...) {
+		if name == cfg.Theme() {
+			fmt.Println("* " + name)
+		} else {
+			fmt.Println("  " + name)
+		}
+	}
+	return nil
+}
+
+// cmdThemeInstall copy the theme directory src into themes directory.
+// The theme is named after src if name is empty.
+func cmdThemeInstall(src string, name string, overWrite bool) error {
+	if name == "" {
+		name = filepath.Base(filepath.Clean(src))
+	}
+	if name == common.DEFAULT_THEME || name == "." || strings.ContainsAny(name, `/\`) ||
+		strings.HasPrefix(name, ".") {
+		return errors.New("invalid theme name: " + name)
+	}
+	if !common.DirectoryExist(src) {
+		return &common.ErrDirectoryNotExists{Path: src}
+	}
+	dst := filepath.Join(common.PathThemeDir(), name)
+	if common.PathExists(dst) {
+		if !overWrite {
+			return &common.ErrThemeExists{Name: name}
+		}
+		err := os.RemoveAll(dst)
+		if err != nil {
+			return err
+		}
+	}
+	err := common.CopyDir(src, dst)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Theme " + name + " installed.")
+	return nil
+}
+
+// cmdThemeUse set the theme in config. It works after server restarts.
+func cmdThemeUse(name string) error {
+	if name != common.DEFAULT_THEME && !common.DirectoryExist(filepath.Join(common.PathThemeDir(), name)) {
+		return &common.ErrNoSuchTheme{Name: name}
+	}
+	cfg, err := config.OpenFileConfig()
+	if err != nil {
+		return err
+	}
+	cfg.SetTheme(name)
+	err = cfg.WriteBack()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Theme " + name + " is in use. Restart the server to apply it.")
+	return nil
+}
+
+// installedThemes return the names of themes in themes directory.
+func installedThemes() ([]string, error) {
+	dir := common.PathThemeDir()
+	if !common.DirectoryExist(dir) {
+		return nil, nil
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			res = append(res, entry.Name())
+		}
+	}
+	return res, nil
+}
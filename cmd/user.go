@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-blog/common"
+	"go-blog/services"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// cmdUserAdd add a user with role. Password is read from terminal.
+func cmdUserAdd(name string, role string) error {
+	if !services.IsRole(role) {
+		return errors.New("unknown role: " + role)
+	}
+	if name == "" || strings.ContainsAny(name, " \t\r\n") {
+		return errors.New("invalid user name: " + name)
+	}
+	users, err := services.OpenFileUserStore(common.PathUserStore())
+	if err != nil {
+		return err
+	}
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	user := &services.User{Name: name, Role: role, Created: time.Now()}
+	err = user.SetPassword(password)
+	if err != nil {
+		return err
+	}
+	err = users.Add(user)
+	if err != nil {
+		return err
+	}
+	fmt.Println("User " + name + " added as " + role + ".")
+	return nil
+}
+
+// cmdUserPasswd change the password of user, which ends its sessions.
+func cmdUserPasswd(name string) error {
+	users, err := services.OpenFileUserStore(common.PathUserStore())
+	if err != nil {
+		return err
+	}
+	// Check the user first so that a password would not be asked in vain.
+	user, err := users.Get(name)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return &common.ErrNoSuchUser{Name: name}
+	}
+	password, err := readNewPassword()
+	if err != nil {
+		return err
+	}
+	err = users.Update(name, func(user *services.User) error {
+		return user.SetPassword(password)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Password of " + name + " changed.")
+	return nil
+}
+
+// cmdUserRole change the role of user.
+func cmdUserRole(name string, role string) error {
+	if !services.IsRole(role) {
+		return errors.New("unknown role: " + role)
+	}
+	users, err := services.OpenFileUserStore(common.PathUserStore())
+	if err != nil {
+		return err
+	}
+	err = users.Update(name, func(user *services.User) error {
+		user.Role = role
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("User " + name + " is " + role + " now.")
+	return nil
+}
+
+func cmdUserRemove(name string) error {
+	users, err := services.OpenFileUserStore(common.PathUserStore())
+	if err != nil {
+		return err
+	}
+	err = users.Delete(name)
+	if err != nil {
+		return err
+	}
+	fmt.Println("User " + name + " removed.")
+	return nil
+}
+
+func cmdUserList() error {
+	users, err := services.OpenFileUserStore(common.PathUserStore())
+	if err != nil {
+		return err
+	}
+	list, err := users.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Println("No user.")
+		return nil
+	}
+	for _, u := range list {
+		fmt.Printf("%-20s %-8s %s\n", u.Name, u.Role, u.Created.Format("2006-01-02 15:04"))
+	}
+	return nil
+}
+
+// readNewPassword read a password twice from terminal without echo.
+// If stdin is not a terminal, the password is read once from the first line of it,
+// so that users can be added by scripts.
+func readNewPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", errors.New("no password from stdin")
+		}
+		return checkPassword(strings.TrimRight(line, "\r\n"))
+	}
+
+	fmt.Print("Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	fmt.Print("Password again: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", errors.New("passwords do not match")
+	}
+	return checkPassword(string(first))
+}
+
+func checkPassword(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// MoreMarker split the abstract of a note from the rest of it.
+const MoreMarker = "<!--more-->"
+
+// DefaultAbstractLength is the max number of characters of an abstract
+// generated without MoreMarker.
+const DefaultAbstractLength = 200
+
+// MdAbstract generate the abstract of markdown source whose ast is doc.
+// The plain text before MoreMarker would be used if there is one,
+// otherwise the plain text of whole document truncated to limit characters.
+// MoreMarker is only taken as a html block of its own line, not in code or inline html.
+// Markups, code blocks and html are stripped.
+func MdAbstract(source []byte, doc ast.Node, limit int) string {
+	if more := moreMarker(source, doc); more != nil {
+		return plainText(source, doc, more)
+	}
+	return TruncateText(MdPlainText(source, doc), limit)
+}
+
+// moreMarker return the html block of MoreMarker in doc, nil if there is none.
+func moreMarker(source []byte, doc ast.Node) ast.Node {
+	var res ast.Node
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Kind() != ast.KindHTMLBlock {
+			return ast.WalkContinue, nil
+		}
+		lines := n.Lines()
+		if lines.Len() != 1 {
+			return ast.WalkSkipChildren, nil
+		}
+		line := lines.At(0)
+		if string(bytes.TrimSpace(line.Value(source))) == MoreMarker {
+			res = n
+			return ast.WalkStop, nil
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return res
+}
+
+// MdPlainTextOf parse markdown source with CurrentMdRenderer and extract its plain text.
+func MdPlainTextOf(source []byte) string {
+	return MdPlainText(source, CurrentMdRenderer().Markdown().Parser().Parse(text.NewReader(source)))
+}
+
+// MdPlainText extract the text of doc with markups stripped.
+// Blocks are joined by a single space.
+func MdPlainText(source []byte, doc ast.Node) string {
+	return plainText(source, doc, nil)
+}
+
+// plainText is MdPlainText, but only the text before node stop is extracted if it is not nil.
+func plainText(source []byte, doc ast.Node, stop ast.Node) string {
+	var buf bytes.Buffer
+	space := func() {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte(" ")) {
+			buf.WriteByte(' ')
+		}
+	}
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if n == stop {
+			return ast.WalkStop, nil
+		}
+		switch n.Kind() {
+		case ast.KindFencedCodeBlock, ast.KindCodeBlock, ast.KindHTMLBlock, ast.KindRawHTML, ast.KindImage, KindMathBlock:
+			return ast.WalkSkipChildren, nil
+		case KindMathInline:
+			if entering {
+				buf.Write(n.(*MathInline).Segment.Value(source))
+			}
+		case ast.KindText:
+			if entering {
+				t := n.(*ast.Text)
+				buf.Write(t.Segment.Value(source))
+				if t.SoftLineBreak() || t.HardLineBreak() {
+					space()
+				}
+			}
+		case ast.KindString:
+			if entering {
+				buf.Write(n.(*ast.String).Value)
+			}
+		default:
+			if n.Type() == ast.TypeBlock {
+				space()
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(buf.String())
+}
+
+// TruncateText cut s to at most limit characters and append "…" if cut.
+// Latin words would not be cut in the middle, while CJK text can be cut anywhere
+// since there is no space between words.
+// It return "" if limit is not positive.
+func TruncateText(s string, limit int) string {
+	if limit <= 0 {
+		return ""
+	}
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	cut := limit
+	if !IsCJK(runes[cut-1]) && !unicode.IsSpace(runes[cut]) && !IsCJK(runes[cut]) {
+		// Back to the beginning of the word being cut.
+		i := cut - 1
+		for i > 0 && !unicode.IsSpace(runes[i]) && !IsCJK(runes[i]) {
+			i--
+		}
+		if i > 0 {
+			if IsCJK(runes[i]) {
+				i++
+			}
+			cut = i
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}) + "…"
+}
+
+// IsCJK report whether r is a Chinese, Japanese or Korean character or punctuation.
+func IsCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef) // CJK punctuation and full width forms.
+}
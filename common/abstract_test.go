@@ -0,0 +1,65 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		limit int
+		want  string
+	}{
+		{"short", "hello world", 20, "hello world"},
+		{"exact", "hello", 5, "hello"},
+		{"cut at space", "hello world", 6, "hello…"},
+		{"back to word start", "hello world", 8, "hello…"},
+		{"single long word", "helloworld", 5, "hello…"},
+		{"trailing punctuation", "hello, world", 7, "hello…"},
+		{"cjk", "你好世界再见", 4, "你好世界…"},
+		{"cjk after latin", "go语言很好", 3, "go语…"},
+		{"empty", "", 3, ""},
+		{"zero limit", "hello", 0, ""},
+		{"negative limit", "hello", -1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TruncateText(tt.s, tt.limit); got != tt.want {
+				t.Errorf("TruncateText(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMdAbstract(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		limit int
+		want  string
+	}{
+		{"markup stripped", "# Title\n\nSome *emphasis* and `code` with [a link](x.md).\n", 100, "Title Some emphasis and code with a link."},
+		{"code and html skipped", "Before\n\n```go\nfunc main() {}\n```\n\n<div>html</div>\n\nAfter\n", 100, "Before After"},
+		{"truncated", "one two three four\n", 9, "one two…"},
+		{"more marker", "Intro *text*\n\n<!--more-->\n\nRest of note\n", 5, "Intro text"},
+		{"more marker in list", "Intro\n\n- item\n\n  <!--more-->\n\n  rest\n", 100, "Intro item"},
+		{"more marker in code", "Intro\n\n```html\n<!--more-->\n```\n\nRest of note\n", 100, "Intro Rest of note"},
+		{"more marker in code span", "Intro `<!--more-->` rest\n", 100, "Intro <!--more--> rest"},
+		{"more marker in html block", "Intro\n\n<div>\n<!--more-->\n</div>\n\nRest of note\n", 100, "Intro Rest of note"},
+		{"empty", "", 10, ""},
+	}
+	p := goldmark.New().Parser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte(tt.src)
+			doc := p.Parse(text.NewReader(src))
+			if got := MdAbstract(src, doc, tt.limit); got != tt.want {
+				t.Errorf("MdAbstract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
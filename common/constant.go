@@ -1,7 +1,6 @@
 package common
 
 import (
-	"log"
 	"os"
 	"path/filepath"
 )
@@ -9,6 +8,11 @@ import (
 const DEFAULT_CFG_DIR = ".RiftenGoBlog"
 const ENV_CFG_DIR = "GOBLOG_CFG"
 const ENV_RESOURCE_DIR = "GO_BLOG_RES"
+const DEFAULT_SITE_NAME = "Go Blog"
+// DEFAULT_THEME is the name of resource directory itself, which every theme falls back to.
+const DEFAULT_THEME = "default"
+// NOTE_STORE_BOLT is the note store kind in config which persists note tree in a bbolt file.
+const NOTE_STORE_BOLT = "bolt"
 
 // PathCfgDir return the path of repo directory.
 // It would be $HOME/.RiftenGoBlog by default.
@@ -31,6 +35,52 @@ func PathCfgFile() string {
 	return filepath.Join(dir, "config.json")
 }
 
+// PathNoteDir return the default notes root directory.
+func PathNoteDir() string {
+	return filepath.Join(PathCfgDir(), "notes")
+}
+
+// PathCacheDir return the default directory notes are rendered into.
+func PathCacheDir() string {
+	return filepath.Join(PathCfgDir(), "cache")
+}
+
+// PathNoteIndex return the path of the note tree index written by note service.
+func PathNoteIndex() string {
+	return filepath.Join(PathCfgDir(), "notes.json")
+}
+
+// PathNoteStore return the path of the note store file used instead of note index.
+func PathNoteStore() string {
+	return filepath.Join(PathCfgDir(), "notes.db")
+}
+
+// PathSearchIndex return the path of the full-text search index of notes.
+func PathSearchIndex() string {
+	return filepath.Join(PathCfgDir(), "search.idx")
+}
+
+// PathUserStore return the path of the file keeping users.
+func PathUserStore() string {
+	return filepath.Join(PathCfgDir(), "users.json")
+}
+
+// PathSessionKey return the path of the key signing session cookies.
+func PathSessionKey() string {
+	return filepath.Join(PathCfgDir(), "session.key")
+}
+
+// PathAdminToken return the path of the token authorizing commands sent to server.
+func PathAdminToken() string {
+	return filepath.Join(PathCfgDir(), "admin.token")
+}
+
+// PathThemeDir return the directory themes are installed into.
+// Each theme is a sub directory with the same layout as resource directory.
+func PathThemeDir() string {
+	return filepath.Join(PathCfgDir(), "themes")
+}
+
 func PathResDir() string {
 	dir := os.Getenv(ENV_RESOURCE_DIR)
 	if dir != "" {
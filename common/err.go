@@ -1,6 +1,11 @@
 package common
 
-import "errors"
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 type ErrCfgExists struct {
 	Path string
@@ -34,6 +39,46 @@ func (e *ErrDirectoryNotExists) Error() string {
 	return "directory " + e.Path + " not exists"
 }
 
+type ErrNoSuchTheme struct {
+	Name string
+}
+
+func (e *ErrNoSuchTheme) Error() string {
+	return "no such theme: " + e.Name
+}
+
+type ErrThemeExists struct {
+	Name string
+}
+
+func (e *ErrThemeExists) Error() string {
+	return "theme " + e.Name + " already exists"
+}
+
+type ErrNoSuchUser struct {
+	Name string
+}
+
+func (e *ErrNoSuchUser) Error() string {
+	return "no such user: " + e.Name
+}
+
+type ErrUserExists struct {
+	Name string
+}
+
+func (e *ErrUserExists) Error() string {
+	return "user " + e.Name + " already exists"
+}
+
+type ErrLocked struct {
+	Path string
+}
+
+func (e *ErrLocked) Error() string {
+	return "timeout when waiting for lock " + e.Path
+}
+
 var ErrEmptyRelative = errors.New("empty relative path")
 
 type ErrNoSuchNode struct {
@@ -41,4 +86,50 @@ type ErrNoSuchNode struct {
 }
 func (e *ErrNoSuchNode) Error() string {
 	return "no such node: " + e.Relative
-}
\ No newline at end of file
+}
+
+// ErrFailures collects the errors of a batch operation on files
+// so that a single bad file would not stop the whole batch.
+type ErrFailures struct {
+	Failures map[string]error // Keyed by file path.
+}
+
+func (e *ErrFailures) Error() string {
+	paths := make([]string, 0, len(e.Failures))
+	for path := range e.Failures {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	msgs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		msgs = append(msgs, path+": "+e.Failures[path].Error())
+	}
+	return strconv.Itoa(len(paths)) + " file(s) failed: " + strings.Join(msgs, "; ")
+}
+
+// Add records err for path. Nil errors are ignored.
+func (e *ErrFailures) Add(path string, err error) {
+	if err == nil {
+		return
+	}
+	if e.Failures == nil {
+		e.Failures = make(map[string]error)
+	}
+	e.Failures[path] = err
+}
+
+// ErrOrNil return nil if nothing failed so that the result can be returned as error directly.
+func (e *ErrFailures) ErrOrNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+type ErrNodeExists struct {
+	Relative string
+}
+
+func (e *ErrNodeExists) Error() string {
+	return "node already exists: " + e.Relative
+}
@@ -0,0 +1,234 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// FrontMatter is the metadata written at the beginning of a markdown file,
+// between "---" lines in YAML or between "+++" lines in TOML:
+//		---
+//		title: Hello
+//		date: 2020-01-02
+//		tags: [go, blog]
+//		---
+// Fields not listed here are kept in Params.
+type FrontMatter struct {
+	Title      string
+	Date       time.Time // Created date.
+	Updated    time.Time
+	Tags       []string
+	Categories []string
+	Draft      bool
+	Pinned     bool   // Pinned to the top of home page.
+	Summary    string
+	Visibility string // Who can see the note, such as public or private. Empty to inherit from directory.
+	Math       *bool  `json:",omitempty"` // Whether to render math in the note. nil to follow the site.
+	Toc        *bool  `json:",omitempty"` // Whether to generate table of contents. nil means true.
+	Params     map[string]interface{} `json:",omitempty"`
+}
+
+var fmDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// SplitFrontMatter split the front matter from the markdown source data.
+// It return nil front matter and data itself if there is no front matter,
+// which is also the case if the opening delimiter is not closed,
+// since it is likely a thematic break in markdown.
+// A closed block which does not parse as YAML or TOML is an error,
+// so that a note with broken front matter is not published as it is.
+// The body returned would not contain the front matter.
+func SplitFrontMatter(data []byte) (*FrontMatter, []byte, error) {
+	var delimiter string
+	switch {
+	case bytes.HasPrefix(data, []byte("---")):
+		delimiter = "---"
+	case bytes.HasPrefix(data, []byte("+++")):
+		delimiter = "+++"
+	default:
+		return nil, data, nil
+	}
+
+	// The opening delimiter should take a whole line.
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	if strings.TrimSpace(string(firstLine)) != delimiter {
+		return nil, data, nil
+	}
+
+	// rest starts with the line break of the opening delimiter.
+	rest := data[len(firstLine):]
+	var raw, body []byte
+	found := false
+	for pos := 0; pos < len(rest) && !found; {
+		start := pos + 1
+		end := len(rest)
+		if i := bytes.IndexByte(rest[start:], '\n'); i >= 0 {
+			end = start + i
+		}
+		if strings.TrimSpace(string(rest[start:end])) == delimiter {
+			raw = rest[:pos]
+			body = rest[end:]
+			found = true
+		}
+		pos = end
+	}
+	if !found {
+		return nil, data, nil
+	}
+	body = bytes.TrimLeft(body, "\r\n")
+
+	values := make(map[string]interface{})
+	var err error
+	if delimiter == "---" {
+		var yamlValues map[interface{}]interface{}
+		err = yaml.Unmarshal(raw, &yamlValues)
+		for k, v := range yamlValues {
+			values[fmt.Sprint(k)] = fmNormalize(v)
+		}
+	} else {
+		_, err = toml.Decode(string(raw), &values)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("front matter: %v", err)
+	}
+
+	fm, err := newFrontMatter(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fm, body, nil
+}
+
+func newFrontMatter(values map[string]interface{}) (*FrontMatter, error) {
+	fm := &FrontMatter{Params: make(map[string]interface{})}
+	var err error
+	for key, value := range values {
+		switch strings.ToLower(key) {
+		case "title":
+			fm.Title = fmString(value)
+		case "date", "created":
+			fm.Date, err = fmTime(value)
+		case "updated", "lastmod", "modified":
+			fm.Updated, err = fmTime(value)
+		case "tags":
+			fm.Tags = fmStrings(value)
+		case "categories", "category":
+			fm.Categories = fmStrings(value)
+		case "draft":
+			fm.Draft, err = fmBool(value)
+		case "pinned", "pin", "sticky":
+			fm.Pinned, err = fmBool(value)
+		case "summary", "description":
+			fm.Summary = fmString(value)
+		case "visibility":
+			fm.Visibility = strings.ToLower(fmString(value))
+		case "math", "katex":
+			var math bool
+			math, err = fmBool(value)
+			fm.Math = &math
+		case "toc":
+			var toc bool
+			toc, err = fmBool(value)
+			fm.Toc = &toc
+		default:
+			fm.Params[strings.ToLower(key)] = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("front matter %s: %v", key, err)
+		}
+	}
+	return fm, nil
+}
+
+func fmTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range fmDateLayouts {
+			t, err := time.ParseInLocation(layout, v, time.Local)
+			if err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, errors.New("unknown date format " + v)
+	}
+	return time.Time{}, fmt.Errorf("unknown date %v", value)
+}
+
+func fmBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(v) {
+		case "true", "yes":
+			return true, nil
+		case "false", "no", "":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+// fmString return "" for empty values, such as "title:" in YAML, instead of "<nil>".
+func fmString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// fmStrings accept both a list and a comma separated string. Empty items are skipped.
+func fmStrings(value interface{}) []string {
+	var res []string
+	switch v := value.(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range v {
+			if item := strings.TrimSpace(fmString(item)); item != "" {
+				res = append(res, item)
+			}
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+	default:
+		res = append(res, fmt.Sprint(v))
+	}
+	return res
+}
+
+// fmNormalize convert maps decoded by yaml into map[string]interface{},
+// so that front matter can be encoded into json.
+func fmNormalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			res[fmt.Sprint(key)] = fmNormalize(item)
+		}
+		return res
+	case []interface{}:
+		for i, item := range v {
+			v[i] = fmNormalize(item)
+		}
+	}
+	return value
+}
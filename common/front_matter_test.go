@@ -0,0 +1,110 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		meta    bool // Whether front matter is found.
+		title   string
+		tags    []string
+		body    string
+		wantErr bool
+	}{
+		{
+			name: "no front matter",
+			data: "# Hello\n",
+			body: "# Hello\n",
+		},
+		{
+			name:  "yaml",
+			data:  "---\ntitle: Hello\ntags: [go, blog]\n---\n\n# Body\n",
+			meta:  true,
+			title: "Hello",
+			tags:  []string{"go", "blog"},
+			body:  "# Body\n",
+		},
+		{
+			name:  "toml",
+			data:  "+++\ntitle = \"Hello\"\ntags = \"go, blog\"\n+++\nBody\n",
+			meta:  true,
+			title: "Hello",
+			tags:  []string{"go", "blog"},
+			body:  "Body\n",
+		},
+		{
+			name:  "crlf",
+			data:  "---\r\ntitle: Hello\r\n---\r\nBody\r\n",
+			meta:  true,
+			title: "Hello",
+			body:  "Body\r\n",
+		},
+		{
+			name: "empty front matter",
+			data: "---\n---\nBody\n",
+			meta: true,
+			body: "Body\n",
+		},
+		{
+			name: "empty values",
+			data: "---\ntitle:\ntags: [go, ~, \"\"]\ncategories:\n---\nBody\n",
+			meta: true,
+			tags: []string{"go"},
+			body: "Body\n",
+		},
+		{
+			name: "delimiter not a whole line",
+			data: "--- not front matter\n---\n",
+			body: "--- not front matter\n---\n",
+		},
+		{
+			name: "thematic break not closed",
+			data: "---\n\nSome text\n",
+			body: "---\n\nSome text\n",
+		},
+		{
+			name:    "not yaml",
+			data:    "---\njust a line\n---\nBody\n",
+			wantErr: true,
+		},
+		{
+			name:    "not toml",
+			data:    "+++\nnot toml\n+++\nBody\n",
+			wantErr: true,
+		},
+		{
+			name:    "bad value",
+			data:    "---\ndate: someday\n---\nBody\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta, body, err := SplitFrontMatter([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SplitFrontMatter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (meta != nil) != tt.meta {
+				t.Fatalf("SplitFrontMatter() meta = %v, want found %v", meta, tt.meta)
+			}
+			if meta != nil {
+				if meta.Title != tt.title {
+					t.Errorf("Title = %q, want %q", meta.Title, tt.title)
+				}
+				if !reflect.DeepEqual(meta.Tags, tt.tags) {
+					t.Errorf("Tags = %q, want %q", meta.Tags, tt.tags)
+				}
+			}
+			if string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
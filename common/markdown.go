@@ -1,10 +1,12 @@
 package common
 
 import (
-	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // MdRenderRecursively render all markdown files in src
@@ -15,7 +17,18 @@ import (
 // dst would be created if not exists.
 // File in dst would be overwritten if overWrite is true.
 // File without .md ext would be copied to dst if copyOthers is true.
+// Links between notes in src are rewritten to link their html files in dst.
 func MdRenderRecursively(src string, dst string, overWrite bool, copyOthers bool) error {
+	root := src
+	if !DirectoryExist(src) {
+		root = filepath.Dir(src)
+	}
+	return mdRenderRecursively(root, mdNoteNames(root), src, dst, overWrite, copyOthers)
+}
+
+// mdRenderRecursively render src under root like MdRenderRecursively,
+// resolving wikilinks with names of all notes under root.
+func mdRenderRecursively(root string, names map[string]string, src string, dst string, overWrite bool, copyOthers bool) error {
 	si, err := os.Stat(src)
 	if err != nil {
 		return err
@@ -38,7 +51,7 @@ func MdRenderRecursively(src string, dst string, overWrite bool, copyOthers bool
 			srcPath := filepath.Join(src, entry.Name())
 			dstPath := filepath.Join(dst, entry.Name())
 
-			err = MdRenderRecursively(srcPath, dstPath, overWrite, copyOthers)
+			err = mdRenderRecursively(root, names, srcPath, dstPath, overWrite, copyOthers)
 			if err != nil {
 				return err
 			}
@@ -50,29 +63,102 @@ func MdRenderRecursively(src string, dst string, overWrite bool, copyOthers bool
 			}
 		} else {
 			dstPath := ChExt(dst, ".html")
-			return MdRenderFile(src, dstPath)
+			return mdRenderStatic(root, names, src, dstPath)
 		}
 	}
 	return nil
 }
 
+// MdResult is what rendering a note produces besides the html file.
+type MdResult struct {
+	Meta     *FrontMatter // nil if the note has no front matter.
+	Abstract string       // Summary in front matter, or generated by MdAbstract.
+	Math     bool         // Whether the note contains math, which needs KaTeX to display.
+	Toc      []*TocItem   // Table of contents. nil if it is disabled by front matter.
+	// Paths of notes linked, which are slash separated and relative to notes root.
+	Links []string
+	// Targets of links to notes which can not be found, such as ../missing.md and [[Missing]].
+	BrokenLinks []string
+}
+
 // MdRenderFile render markdown file src to html file dst.
 // dst would be src with extension replaced by ".html" if dst is "".
 // dst would be overwritten if exists.
 // dst would be created if not exists.
+// Front matter of src would not be rendered.
+// Links to other notes in the directory of src are rewritten to link their html files.
 func MdRenderFile(src string, dst string) error {
+	return mdRenderStatic(filepath.Dir(src), nil, src, dst)
+}
+
+// MdRenderNote is the same as MdRenderFile but also return
+// the front matter and other infos collected while rendering.
+// Notes are rendered by CurrentMdRenderer.
+func MdRenderNote(src string, dst string) (*MdResult, error) {
+	return CurrentMdRenderer().RenderNote(src, dst, MdStaticLinks(filepath.Dir(src), src))
+}
+
+// mdRenderStatic render note src under root to html file dst, and log its broken links.
+// Wikilinks are resolved with names, which are collected from root if it is nil.
+func mdRenderStatic(root string, names map[string]string, src string, dst string) error {
+	links := MdStaticLinks(root, src)
+	links.Names = names
+	res, err := CurrentMdRenderer().RenderNote(src, dst, links)
+	if err != nil {
+		return err
+	}
+	if len(res.BrokenLinks) > 0 {
+		log.Warn("Broken links in ", src, ": ", strings.Join(res.BrokenLinks, ", "))
+	}
+	return nil
+}
+
+// RenderNote render markdown file src to html file dst like MdRenderNote.
+// Links to other notes are resolved by links, and kept as they are if links is nil.
+func (r *MdRenderer) RenderNote(src string, dst string, links *MdLinks) (*MdResult, error) {
 	if dst == "" {
-		// TODO: Is it safe to change string parameter directly?
 		dst = ChExt(src, ".html")
 	}
 	input, err := ioutil.ReadFile(src)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	meta, body, err := SplitFrontMatter(input)
+	if err != nil {
+		return nil, err
 	}
 	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer out.Close()
-	return goldmark.Convert(input, out)
-}
\ No newline at end of file
+
+	md := r.md
+	pc := parser.NewContext()
+	if links != nil {
+		links.Meta = meta
+		pc.Set(mdLinksKey, links)
+	}
+	if meta != nil && meta.Math != nil {
+		pc.Set(mathEnabledKey, *meta.Math)
+	}
+	doc := md.Parser().Parse(text.NewReader(body), parser.WithContext(pc))
+	err = md.Renderer().Render(out, body, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MdResult{Meta: meta}
+	res.Math, _ = pc.Get(mathFoundKey).(bool)
+	res.Links, _ = pc.Get(mdLinkedKey).([]string)
+	res.BrokenLinks, _ = pc.Get(mdBrokenLinksKey).([]string)
+	if meta == nil || meta.Toc == nil || *meta.Toc {
+		res.Toc = MdToc(body, doc)
+	}
+	if meta != nil && meta.Summary != "" {
+		res.Abstract = meta.Summary
+	} else {
+		res.Abstract = MdAbstract(body, doc, DefaultAbstractLength)
+	}
+	return res, nil
+}
@@ -0,0 +1,344 @@
+package common
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MdLinks resolve links between notes under Root while rendering the note at path Note.
+// Targets are slash separated paths relative to Root, such as dir/other.md,
+// which are turned into urls by URL.
+type MdLinks struct {
+	Root string
+	Note string
+	URL  func(target string) string
+	// Names map the lower cased names and paths without .md of notes to their paths, see MdNoteNames.
+	// It is built from notes on disk under Root on first wikilink if it is nil.
+	Names map[string]string
+	// Visible report whether the note at target can be linked.
+	// Links to notes it hides are taken as broken. All notes can be linked if it is nil.
+	Visible func(target string) bool
+	// Meta is the front matter of the note being rendered, which is set by RenderNote.
+	Meta *FrontMatter
+}
+
+// MdStaticLinks return links of note rendered to html files beside each other,
+// which link to the html file of target relative to note.
+func MdStaticLinks(root string, note string) *MdLinks {
+	return &MdLinks{
+		Root: root,
+		Note: note,
+		URL: func(target string) string {
+			rel, err := filepath.Rel(filepath.Dir(note), filepath.Join(root, filepath.FromSlash(target)))
+			if err != nil {
+				return ChExt(target, ".html")
+			}
+			return ChExt(filepath.ToSlash(rel), ".html")
+		},
+	}
+}
+
+// ResolveNote return the path of note linked by link relative to the note being rendered, such as ../other.md.
+// It return false if link is not a visible note under Root.
+func (l *MdLinks) ResolveNote(link string) (string, bool) {
+	abs := filepath.Join(filepath.Dir(l.Note), filepath.FromSlash(link))
+	rel, err := filepath.Rel(l.Root, abs)
+	if err != nil {
+		return "", false
+	}
+	target := filepath.ToSlash(rel)
+	if !isNotePath(target) || !FileExist(abs) || !l.visible(target) {
+		return "", false
+	}
+	return target, true
+}
+
+// ResolveWiki return the path of note linked by [[name]].
+// name is either the file name of note without .md, or its path relative to the note being rendered or Root.
+// Names are case insensitive, and the first note in lexical order is taken if several notes have the same name.
+// It return false if there is no such note or it is not visible.
+func (l *MdLinks) ResolveWiki(name string) (string, bool) {
+	if l.Names == nil {
+		l.Names = mdNoteNames(l.Root)
+	}
+	key := strings.ToLower(strings.TrimSuffix(strings.Trim(name, "/"), ".md"))
+	keys := []string{key}
+	if dir, err := filepath.Rel(l.Root, filepath.Dir(l.Note)); err == nil && strings.Contains(key, "/") {
+		keys = append([]string{strings.ToLower(path.Join(filepath.ToSlash(dir), key))}, keys...)
+	}
+	for _, k := range keys {
+		if target, ok := l.Names[k]; ok {
+			if !l.visible(target) {
+				return "", false
+			}
+			return target, true
+		}
+	}
+	return "", false
+}
+
+func (l *MdLinks) visible(target string) bool {
+	return l.Visible == nil || l.Visible(target)
+}
+
+// isNotePath report whether rel, a slash separated path relative to notes root,
+// is a markdown file inside the root that is not hidden.
+func isNotePath(rel string) bool {
+	if rel == ".." || strings.HasPrefix(rel, "../") || path.Ext(rel) != ".md" {
+		return false
+	}
+	for _, entry := range strings.Split(rel, "/") {
+		if strings.HasPrefix(entry, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// MdNoteNames map the lower cased names and paths without .md of notes to their paths,
+// which are slash separated and relative to notes root.
+// The first path in lexical order is taken if several notes have the same name.
+func MdNoteNames(paths []string) map[string]string {
+	sorted := append([]string(nil), paths...)
+	sort.Strings(sorted)
+	names := make(map[string]string, 2*len(sorted))
+	for _, rel := range sorted {
+		for _, key := range []string{strings.TrimSuffix(rel, ".md"), strings.TrimSuffix(path.Base(rel), ".md")} {
+			key = strings.ToLower(key)
+			if _, ok := names[key]; !ok {
+				names[key] = rel
+			}
+		}
+	}
+	return names
+}
+
+// mdNoteNames return MdNoteNames of notes on disk under root.
+func mdNoteNames(root string) map[string]string {
+	var paths []string
+	_ = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if p != root && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || filepath.Ext(p) != ".md" {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err == nil {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return MdNoteNames(paths)
+}
+
+// mdLinksKey keep *MdLinks in parser context of a note. Links are not resolved without it.
+// mdLinkedKey keep the paths of notes linked.
+// mdBrokenLinksKey keep the targets of links which can not be resolved.
+var (
+	mdLinksKey       = parser.NewContextKey()
+	mdLinkedKey      = parser.NewContextKey()
+	mdBrokenLinksKey = parser.NewContextKey()
+)
+
+// BrokenLinkClass is the class of links whose target can not be found.
+const BrokenLinkClass = "broken-link"
+
+func contextLinks(pc parser.Context) *MdLinks {
+	links, _ := pc.Get(mdLinksKey).(*MdLinks)
+	return links
+}
+
+func addLinked(pc parser.Context, target string) {
+	linked, _ := pc.Get(mdLinkedKey).([]string)
+	for _, t := range linked {
+		if t == target {
+			return
+		}
+	}
+	pc.Set(mdLinkedKey, append(linked, target))
+}
+
+func addBrokenLink(pc parser.Context, target string) {
+	broken, _ := pc.Get(mdBrokenLinksKey).([]string)
+	pc.Set(mdBrokenLinksKey, append(broken, target))
+}
+
+// KindBrokenLink is the kind of BrokenLink in markdown ast.
+var KindBrokenLink = ast.NewNodeKind("BrokenLink")
+
+// BrokenLink is a link to a note which can not be found.
+// It is rendered without destination as:
+//		<span class="broken-link">label</span>
+type BrokenLink struct {
+	ast.BaseInline
+	Target string // The link as it is written, such as [[Missing]] and ../missing.md.
+}
+
+func (n *BrokenLink) Kind() ast.NodeKind {
+	return KindBrokenLink
+}
+
+func (n *BrokenLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target}, nil)
+}
+
+// newBrokenLink return a BrokenLink to target which takes over the children of link,
+// and record target as broken.
+func newBrokenLink(pc parser.Context, target string, link ast.Node) *BrokenLink {
+	addBrokenLink(pc, target)
+	broken := &BrokenLink{Target: target}
+	for child := link.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		broken.AppendChild(broken, child)
+		child = next
+	}
+	return broken
+}
+
+// wikiLinkParser parse [[name]], [[name|label]] and [[name#id]] into links to notes.
+type wikiLinkParser struct{}
+
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	links := contextLinks(pc)
+	if links == nil {
+		return nil
+	}
+	line, seg := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := line[2:end]
+	if len(bytes.TrimSpace(inner)) == 0 || bytes.ContainsAny(inner, "[]") {
+		return nil
+	}
+
+	target := inner
+	label := text.NewSegment(seg.Start+2, seg.Start+end)
+	if i := bytes.IndexByte(inner, '|'); i >= 0 {
+		target = inner[:i]
+		label = text.NewSegment(seg.Start+2+i+1, seg.Start+end)
+	}
+	name, fragment := string(bytes.TrimSpace(target)), ""
+	if i := strings.IndexByte(name, '#'); i >= 0 {
+		name, fragment = name[:i], name[i:]
+	}
+
+	link := ast.NewLink()
+	label = label.TrimLeftSpace(block.Source())
+	link.AppendChild(link, ast.NewTextSegment(label.TrimRightSpace(block.Source())))
+	block.Advance(end + 2)
+	if name == "" {
+		// [[#id]] links to a heading of the note itself.
+		link.Destination = []byte(fragment)
+		return link
+	}
+	note, ok := links.ResolveWiki(name)
+	if !ok {
+		return newBrokenLink(pc, "[["+name+"]]", link)
+	}
+	addLinked(pc, note)
+	link.Destination = []byte(links.URL(note) + fragment)
+	return link
+}
+
+// linkTransformer rewrite relative links to .md files into the urls of notes,
+// and replace links to notes not found with BrokenLink.
+type linkTransformer struct{}
+
+func (t *linkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	links := contextLinks(pc)
+	if links == nil {
+		return
+	}
+	var broken []*ast.Link
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		link, ok := n.(*ast.Link)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		dest := string(link.Destination)
+		if dest == "" || strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "#") {
+			return ast.WalkContinue, nil
+		}
+		u, err := url.Parse(dest)
+		if err != nil || u.Scheme != "" || u.Host != "" || path.Ext(u.Path) != ".md" {
+			return ast.WalkContinue, nil
+		}
+		target, ok := links.ResolveNote(u.Path)
+		if !ok {
+			broken = append(broken, link)
+			return ast.WalkContinue, nil
+		}
+		addLinked(pc, target)
+		resolved := links.URL(target)
+		if u.RawQuery != "" {
+			resolved += "?" + u.RawQuery
+		}
+		if u.Fragment != "" {
+			resolved += "#" + u.Fragment
+		}
+		link.Destination = []byte(resolved)
+		return ast.WalkContinue, nil
+	})
+	// Nodes are replaced after walking, which can not be done while walking them.
+	for _, link := range broken {
+		link.Parent().ReplaceChild(link.Parent(), link, newBrokenLink(pc, string(link.Destination), link))
+	}
+}
+
+// brokenLinkRenderer render BrokenLink as a span, keeping its label.
+type brokenLinkRenderer struct{}
+
+func (r *brokenLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindBrokenLink, r.renderBrokenLink)
+}
+
+func (r *brokenLinkRenderer) renderBrokenLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<span class="` + BrokenLinkClass + `">`)
+	} else {
+		_, _ = w.WriteString("</span>")
+	}
+	return ast.WalkContinue, nil
+}
+
+// linkExtension resolve [[wikilinks]] and relative .md links with the MdLinks in parser context.
+type linkExtension struct{}
+
+func (e *linkExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&wikiLinkParser{}, 199)),
+		parser.WithASTTransformers(util.Prioritized(&linkTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&brokenLinkRenderer{}, 500)))
+}
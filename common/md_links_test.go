@@ -0,0 +1,137 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestLinks create notes in a temporary directory, and return links of the note dir/b.md
+// to which secret.md is not visible.
+func newTestLinks(t *testing.T) *MdLinks {
+	root := t.TempDir()
+	notes := map[string]string{
+		"a.md":         "# A\n",
+		"secret.md":    "# Secret\n",
+		"image.png":    "",
+		"dir/b.md":     "# B\n",
+		"dir/sub/c.md": "# C\n",
+		"other/b.md":   "# Other B\n",
+		".hidden/h.md": "# Hidden\n",
+	}
+	for name, content := range notes {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &MdLinks{
+		Root: root,
+		Note: filepath.Join(root, "dir", "b.md"),
+		URL: func(target string) string {
+			return "/" + strings.TrimSuffix(target, ".md")
+		},
+		Visible: func(target string) bool {
+			return target != "secret.md"
+		},
+	}
+}
+
+func TestResolveNote(t *testing.T) {
+	links := newTestLinks(t)
+	tests := []struct {
+		link   string
+		target string
+		ok     bool
+	}{
+		{"../a.md", "a.md", true},
+		{"sub/c.md", "dir/sub/c.md", true},
+		{"./b.md", "dir/b.md", true},
+		{"../other/b.md", "other/b.md", true},
+		{"missing.md", "", false},
+		{"../../a.md", "", false},
+		{"../.hidden/h.md", "", false},
+		{"../secret.md", "", false},
+		{"../image.png", "", false},
+	}
+	for _, tt := range tests {
+		target, ok := links.ResolveNote(tt.link)
+		if target != tt.target || ok != tt.ok {
+			t.Errorf("ResolveNote(%q) = %q, %v, want %q, %v", tt.link, target, ok, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestResolveWiki(t *testing.T) {
+	links := newTestLinks(t)
+	tests := []struct {
+		name   string
+		target string
+		ok     bool
+	}{
+		{"a", "a.md", true},
+		{"A.md", "a.md", true},
+		{"b", "dir/b.md", true},
+		{"other/b", "other/b.md", true},
+		{"sub/c", "dir/sub/c.md", true},
+		{"/dir/sub/c.md", "dir/sub/c.md", true},
+		{"c", "dir/sub/c.md", true},
+		{"h", "", false},
+		{"secret", "", false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		target, ok := links.ResolveWiki(tt.name)
+		if target != tt.target || ok != tt.ok {
+			t.Errorf("ResolveWiki(%q) = %q, %v, want %q, %v", tt.name, target, ok, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestMdNoteNames(t *testing.T) {
+	got := MdNoteNames([]string{"z/x.md", "a/x.md", "X.md"})
+	want := map[string]string{
+		"x":   "X.md",
+		"a/x": "a/x.md",
+		"z/x": "z/x.md",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MdNoteNames() = %v, want %v", got, want)
+	}
+}
+
+func TestRenderNoteLinks(t *testing.T) {
+	links := newTestLinks(t)
+	src := filepath.Join(links.Root, "dir", "b.md")
+	content := "[A](../a.md#top) [[sub/c|C]] [gone](gone.md) [[secret]] [web](https://example.com/x.md)\n"
+	if err := ioutil.WriteFile(src, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := NewMdRenderer(DefaultMdOptions).RenderNote(src, "", links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := ioutil.ReadFile(ChExt(src, ".html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<p><a href="/a#top">A</a> <a href="/dir/sub/c">C</a> ` +
+		`<span class="broken-link">gone</span> <span class="broken-link">secret</span> ` +
+		`<a href="https://example.com/x.md">web</a></p>` + "\n"
+	if string(html) != want {
+		t.Errorf("html = %q, want %q", html, want)
+	}
+	// Wikilinks are resolved while parsing, before other links.
+	if want := []string{"dir/sub/c.md", "a.md"}; !reflect.DeepEqual(res.Links, want) {
+		t.Errorf("Links = %q, want %q", res.Links, want)
+	}
+	if want := []string{"[[secret]]", "gone.md"}; !reflect.DeepEqual(res.BrokenLinks, want) {
+		t.Errorf("BrokenLinks = %q, want %q", res.BrokenLinks, want)
+	}
+}
@@ -0,0 +1,282 @@
+package common
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindMathInline and KindMathBlock are the kinds of math nodes in markdown ast.
+var (
+	KindMathInline = ast.NewNodeKind("MathInline")
+	KindMathBlock  = ast.NewNodeKind("MathBlock")
+)
+
+// MathInline is math between $ or $$ in a line of text.
+// Its formula is the source in Segment.
+type MathInline struct {
+	ast.BaseInline
+	Segment text.Segment
+	Display bool // Whether it is between $$.
+}
+
+func (n *MathInline) Kind() ast.NodeKind {
+	return KindMathInline
+}
+
+func (n *MathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Formula": string(n.Segment.Value(source))}, nil)
+}
+
+// MathBlock is math between lines starting and ending with $$.
+// Its formula is the source in Lines.
+type MathBlock struct {
+	ast.BaseBlock
+	opening text.Segment // The line opening the block from $$.
+	closed  bool
+}
+
+func (n *MathBlock) Kind() ast.NodeKind {
+	return KindMathBlock
+}
+
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathEnabledKey is set in parser context to enable or disable math of a single note,
+// overriding the option of extension.
+// mathFoundKey is set in parser context once math is found.
+var (
+	mathEnabledKey = parser.NewContextKey()
+	mathFoundKey   = parser.NewContextKey()
+)
+
+// mathEnabled report whether math should be parsed with context pc.
+func mathEnabled(pc parser.Context, def bool) bool {
+	if v, ok := pc.Get(mathEnabledKey).(bool); ok {
+		return v
+	}
+	return def
+}
+
+type mathInlineParser struct {
+	enabled bool
+}
+
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse parse $...$ and $$...$$ in a line.
+// Like pandoc, the opening $ of inline math must not be followed by a space,
+// and the closing $ must not follow a space nor be followed by a digit,
+// so that prices such as $5 and $10 would not be taken as math.
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	if !mathEnabled(pc, p.enabled) {
+		return nil
+	}
+	line, seg := block.PeekLine()
+	display := len(line) > 1 && line[1] == '$'
+	open := 1
+	if display {
+		open = 2
+	}
+	if len(line) <= open || (!display && util.IsSpace(line[open])) {
+		return nil
+	}
+	for i := open; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case line[i] != '$':
+		case display:
+			// A single $ is a part of display math, such as $$a$b$$.
+			if i+1 < len(line) && line[i+1] == '$' && i > open {
+				block.Advance(i + 2)
+				pc.Set(mathFoundKey, true)
+				return &MathInline{Segment: text.NewSegment(seg.Start+open, seg.Start+i), Display: true}
+			}
+		case util.IsSpace(line[i-1]) || (i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9'):
+			return nil
+		default:
+			block.Advance(i + 1)
+			pc.Set(mathFoundKey, true)
+			return &MathInline{Segment: text.NewSegment(seg.Start+open, seg.Start+i)}
+		}
+	}
+	return nil
+}
+
+type mathBlockParser struct {
+	enabled bool
+}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open parse the opening line of math block, which starts with $$.
+// The formula can be in the same line, and the block is closed at once
+// if the line also ends with $$.
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	if !mathEnabled(pc, p.enabled) {
+		return nil, parser.NoChildren
+	}
+	line, seg := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &MathBlock{opening: text.NewSegment(seg.Start+pos, seg.Stop)}
+	start := seg.Start + pos + 2
+	rest := util.TrimRightSpace(line[pos+2:])
+	if len(rest) >= 2 && bytes.HasSuffix(rest, []byte("$$")) {
+		node.Lines().Append(text.NewSegment(start, start+len(rest)-2))
+		node.closed = true
+	} else if len(util.TrimLeftSpace(rest)) > 0 {
+		node.Lines().Append(text.NewSegment(start, seg.Stop))
+	}
+	advanceLine(reader, line)
+	return node, parser.NoChildren
+}
+
+// Continue append lines to math block until the line ending with $$.
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	block := node.(*MathBlock)
+	if block.closed {
+		return parser.Close
+	}
+	line, seg := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if len(trimmed) > 2 {
+			block.Lines().Append(text.NewSegment(seg.Start, seg.Start+len(trimmed)-2))
+		}
+		block.closed = true
+		advanceLine(reader, line)
+		return parser.Close
+	}
+	block.Lines().Append(seg)
+	advanceLine(reader, line)
+	return parser.Continue | parser.NoChildren
+}
+
+// advanceLine advance reader to the end of line but its line break,
+// which is consumed by block parsing itself.
+func advanceLine(reader text.Reader, line []byte) {
+	n := len(line)
+	if n > 0 && line[n-1] == '\n' {
+		n--
+	}
+	reader.Advance(n)
+}
+
+// Close mark that math is found if the block is closed.
+// Blocks not closed until the end of document are not meant to be math,
+// and they are rendered as literal text.
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	if node.(*MathBlock).closed {
+		pc.Set(mathFoundKey, true)
+	}
+}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathRenderer render math nodes into markup with delimiters recognized by KaTeX and MathJax:
+//		<span class="math inline">\(...\)</span>
+//		<div class="math display">\[...\]</div>
+// The formulas are html escaped but otherwise kept as they are.
+type mathRenderer struct{}
+
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMathInline, r.renderMathInline)
+	reg.Register(KindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathRenderer) renderMathInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*MathInline)
+	if n.Display {
+		_, _ = w.WriteString(`<span class="math display">\[`)
+	} else {
+		_, _ = w.WriteString(`<span class="math inline">\(`)
+	}
+	_, _ = w.Write(util.EscapeHTML(n.Segment.Value(source)))
+	if n.Display {
+		_, _ = w.WriteString(`\]</span>`)
+	} else {
+		_, _ = w.WriteString(`\)</span>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*MathBlock)
+	if !n.closed {
+		return r.renderUnclosed(w, source, n)
+	}
+	_, _ = w.WriteString(`<div class="math display">\[`)
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(segment.Value(source)))
+	}
+	_, _ = w.WriteString("\\]</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// renderUnclosed render the source of math block not closed as a paragraph of literal text.
+func (r *mathRenderer) renderUnclosed(w util.BufWriter, source []byte, n *MathBlock) (ast.WalkStatus, error) {
+	_, _ = w.WriteString("<p>")
+	_, _ = w.Write(util.EscapeHTML(util.TrimRightSpace(n.opening.Value(source))))
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		// The formula in the opening line is already written with it.
+		if segment.Start < n.opening.Stop {
+			continue
+		}
+		_ = w.WriteByte('\n')
+		_, _ = w.Write(util.EscapeHTML(util.TrimRightSpace(segment.Value(source))))
+	}
+	_, _ = w.WriteString("</p>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// mathExtension add math to goldmark.
+// Math is parsed if enabled is true, unless it is overridden in parser context of a note.
+type mathExtension struct {
+	enabled bool
+}
+
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{enabled: e.enabled}, 90)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{enabled: e.enabled}, 90)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{}, 500)))
+}
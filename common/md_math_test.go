@@ -0,0 +1,146 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+func TestMath(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		html string
+		math bool // Whether math is found.
+	}{
+		{
+			name: "inline",
+			src:  "Euler $e^{i\\pi}+1=0$.",
+			html: "<p>Euler <span class=\"math inline\">\\(e^{i\\pi}+1=0\\)</span>.</p>\n",
+			math: true,
+		},
+		{
+			name: "prices",
+			src:  "It costs $5 and $10.",
+			html: "<p>It costs $5 and $10.</p>\n",
+		},
+		{
+			name: "space after opening",
+			src:  "$ x$",
+			html: "<p>$ x$</p>\n",
+		},
+		{
+			name: "escaped dollar",
+			src:  "$a\\$b$",
+			html: "<p><span class=\"math inline\">\\(a\\$b\\)</span></p>\n",
+			math: true,
+		},
+		{
+			name: "inline display",
+			src:  "So $$x^2$$ here.",
+			html: "<p>So <span class=\"math display\">\\[x^2\\]</span> here.</p>\n",
+			math: true,
+		},
+		{
+			name: "single dollar in display",
+			src:  "$$a$b$$",
+			html: "<div class=\"math display\">\\[a$b\\]</div>\n",
+			math: true,
+		},
+		{
+			name: "escaped html",
+			src:  "$a<b$",
+			html: "<p><span class=\"math inline\">\\(a&lt;b\\)</span></p>\n",
+			math: true,
+		},
+		{
+			name: "block",
+			src:  "$$\nx = 1\n$$\n",
+			html: "<div class=\"math display\">\\[x = 1\n\\]</div>\n",
+			math: true,
+		},
+		{
+			name: "block interrupting paragraph",
+			src:  "Text\n$$\nx\n$$\n",
+			html: "<p>Text</p>\n<div class=\"math display\">\\[x\n\\]</div>\n",
+			math: true,
+		},
+		{
+			name: "block closed in formula line",
+			src:  "$$\nx = 1$$\n",
+			html: "<div class=\"math display\">\\[x = 1\\]</div>\n",
+			math: true,
+		},
+		{
+			name: "unclosed block",
+			src:  "$$\nx < 1\n",
+			html: "<p>$$\nx &lt; 1</p>\n",
+		},
+		{
+			name: "unclosed block with formula in opening line",
+			src:  "$$ x\ny\n",
+			html: "<p>$$ x\ny</p>\n",
+		},
+	}
+	md := NewMdRenderer(DefaultMdOptions).md
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte(tt.src)
+			pc := parser.NewContext()
+			doc := md.Parser().Parse(text.NewReader(src), parser.WithContext(pc))
+			var buf bytes.Buffer
+			if err := md.Renderer().Render(&buf, src, doc); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.html {
+				t.Errorf("html = %q, want %q", buf.String(), tt.html)
+			}
+			if found, _ := pc.Get(mathFoundKey).(bool); found != tt.math {
+				t.Errorf("math found = %v, want %v", found, tt.math)
+			}
+		})
+	}
+}
+
+func TestMathFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool // Whether math is enabled by options.
+		src     string
+		math    bool
+	}{
+		{"enabled by options", true, "$x$\n", true},
+		{"disabled by options", false, "$x$\n", false},
+		{"disabled by front matter", true, "---\nmath: false\n---\n$x$\n", false},
+		{"enabled by front matter", false, "---\nmath: true\n---\n$x$\n", true},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultMdOptions
+			options.Math = tt.enabled
+			src := filepath.Join(dir, "note.md")
+			if err := ioutil.WriteFile(src, []byte(tt.src), 0644); err != nil {
+				t.Fatal(err)
+			}
+			res, err := NewMdRenderer(options).RenderNote(src, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Math != tt.math {
+				t.Errorf("Math = %v, want %v", res.Math, tt.math)
+			}
+			html, err := ioutil.ReadFile(filepath.Join(dir, "note.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := bytes.Contains(html, []byte(`class="math inline"`)); got != tt.math {
+				t.Errorf("html = %q, want math rendered %v", html, tt.math)
+			}
+		})
+	}
+}
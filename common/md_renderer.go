@@ -0,0 +1,177 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+// MdOptions configure the extensions of markdown renderer.
+type MdOptions struct {
+	GFM            bool `json:"gfm"` // Tables, strikethrough, task lists and autolinks.
+	Footnote       bool `json:"footnote"`
+	DefinitionList bool `json:"definition_list"`
+	Typographer    bool `json:"typographer"` // Smart quotes, dashes and ellipses.
+	HeadingID      bool `json:"heading_id"`  // Generate ids of headings automatically.
+	Unsafe         bool `json:"unsafe"`      // Keep raw html in notes instead of omitting it.
+	// Highlight code blocks with classes of HighlightStyle, whose stylesheet is written by WriteHighlightCSS.
+	// Lines are highlighted by attributes of fence, such as ```go {hl_lines=[2,3]}.
+	Highlight      bool   `json:"highlight"`
+	HighlightStyle string `json:"highlight_style"`
+	LineNumbers    bool   `json:"line_numbers"` // Can be changed for a block by attribute {linenos=false}.
+	// Keep $...$ and $$...$$ from markdown parsing and render them for KaTeX.
+	// Can be changed for a note by "math" in front matter.
+	Math bool `json:"math"`
+}
+
+// DEFAULT_HIGHLIGHT_STYLE is the chroma style of code blocks if none is configured.
+const DEFAULT_HIGHLIGHT_STYLE = "github"
+
+// DefaultMdOptions enable all extensions while raw html is omitted.
+var DefaultMdOptions = MdOptions{
+	GFM:            true,
+	Footnote:       true,
+	DefinitionList: true,
+	Typographer:    true,
+	HeadingID:      true,
+	Unsafe:         false,
+	Highlight:      true,
+	HighlightStyle: DEFAULT_HIGHLIGHT_STYLE,
+	LineNumbers:    false,
+	Math:           true,
+}
+
+// MdRenderer render markdown with the extensions in its options.
+// It is built once and safe for concurrent use.
+type MdRenderer struct {
+	md      goldmark.Markdown
+	options MdOptions
+}
+
+// NewMdRenderer build a renderer with options.
+func NewMdRenderer(options MdOptions) *MdRenderer {
+	var exts []goldmark.Extender
+	if options.GFM {
+		exts = append(exts, extension.GFM)
+	}
+	if options.Footnote {
+		exts = append(exts, extension.Footnote)
+	}
+	if options.DefinitionList {
+		exts = append(exts, extension.DefinitionList)
+	}
+	if options.Typographer {
+		exts = append(exts, extension.Typographer)
+	}
+	if options.Highlight {
+		exts = append(exts, highlighting.NewHighlighting(
+			highlighting.WithStyle(options.HighlightStyle),
+			highlighting.WithFormatOptions(
+				chromahtml.WithClasses(true),
+				chromahtml.WithLineNumbers(options.LineNumbers),
+				chromahtml.LineNumbersInTable(true),
+			),
+		))
+	}
+	// Math is always added so that it can be enabled by front matter of notes.
+	exts = append(exts, &mathExtension{enabled: options.Math}, &linkExtension{})
+	var parserOptions []parser.Option
+	if options.HeadingID {
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+	var rendererOptions []goldmark.Option
+	if options.Unsafe {
+		rendererOptions = append(rendererOptions, goldmark.WithRendererOptions(html.WithUnsafe()))
+	}
+	return &MdRenderer{
+		md: goldmark.New(append(rendererOptions,
+			goldmark.WithExtensions(exts...),
+			goldmark.WithParserOptions(parserOptions...),
+		)...),
+		options: options,
+	}
+}
+
+// Markdown return the goldmark instance of r.
+func (r *MdRenderer) Markdown() goldmark.Markdown {
+	return r.md
+}
+
+// Signature return a short hash of options of r.
+// Notes rendered with a different signature should be rendered again.
+func (r *MdRenderer) Signature() string {
+	data, _ := json.Marshal(r.options)
+	return HashBytes(data)[:16]
+}
+
+// Options return the options r is built with.
+func (r *MdRenderer) Options() MdOptions {
+	return r.options
+}
+
+// highlightStyle return the chroma style of code blocks, falling back to the default one for unknown names.
+func (r *MdRenderer) highlightStyle() *chroma.Style {
+	style, ok := styles.Registry[r.options.HighlightStyle]
+	if !ok {
+		style = styles.Get(DEFAULT_HIGHLIGHT_STYLE)
+	}
+	return style
+}
+
+// WriteHighlightCSS write the stylesheet of highlighted code blocks to path.
+// The file is only replaced if its content changes, and is removed if highlighting is disabled.
+func (r *MdRenderer) WriteHighlightCSS(path string) error {
+	if !r.options.Highlight {
+		if FileExist(path) {
+			return os.Remove(path)
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, r.highlightStyle())
+	if err != nil {
+		return err
+	}
+	old, err := ioutil.ReadFile(path)
+	if err == nil && bytes.Equal(old, buf.Bytes()) {
+		return nil
+	}
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+var (
+	mdRenderer     = NewMdRenderer(DefaultMdOptions)
+	mdRendererLock sync.RWMutex
+)
+
+// SetMdRenderer replace the renderer used by MdRenderFile, MdRenderNote and MdRenderRecursively.
+// It should be called once options are read from config.
+func SetMdRenderer(r *MdRenderer) {
+	mdRendererLock.Lock()
+	defer mdRendererLock.Unlock()
+	mdRenderer = r
+}
+
+// CurrentMdRenderer return the renderer set by SetMdRenderer,
+// or the one with DefaultMdOptions if it is never set.
+func CurrentMdRenderer() *MdRenderer {
+	mdRendererLock.RLock()
+	defer mdRendererLock.RUnlock()
+	return mdRenderer
+}
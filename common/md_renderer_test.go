@@ -0,0 +1,99 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMdRenderer(t *testing.T) {
+	source := "# Title\n\n| a |\n|---|\n| 1 |\n\n<div>raw</div>\n"
+	tests := []struct {
+		name    string
+		options MdOptions
+		want    []string // Fragments the html should contain.
+		notWant []string // Fragments the html should not contain.
+	}{
+		{"default", DefaultMdOptions,
+			[]string{`<h1 id="title">`, "<table>"}, []string{"<div>raw</div>"}},
+		{"none", MdOptions{},
+			[]string{"<h1>"}, []string{"<table>", "<div>raw</div>"}},
+		{"unsafe", MdOptions{Unsafe: true},
+			[]string{"<div>raw</div>"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := NewMdRenderer(tt.options).Markdown().Convert([]byte(source), &buf); err != nil {
+				t.Fatal(err)
+			}
+			html := buf.String()
+			for _, s := range tt.want {
+				if !strings.Contains(html, s) {
+					t.Errorf("html = %q, want %q in it", html, s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(html, s) {
+					t.Errorf("html = %q, want no %q in it", html, s)
+				}
+			}
+		})
+	}
+}
+
+func TestMdRendererSignature(t *testing.T) {
+	changed := DefaultMdOptions
+	changed.Unsafe = true
+	if NewMdRenderer(DefaultMdOptions).Signature() != NewMdRenderer(DefaultMdOptions).Signature() {
+		t.Error("signatures of the same options differ")
+	}
+	if NewMdRenderer(DefaultMdOptions).Signature() == NewMdRenderer(changed).Signature() {
+		t.Error("signatures of different options are the same")
+	}
+}
+
+func TestWriteHighlightCSS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "css", "highlight.css")
+	if err := NewMdRenderer(DefaultMdOptions).WriteHighlightCSS(path); err != nil {
+		t.Fatal(err)
+	}
+	css, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(css), ".chroma") {
+		t.Errorf("stylesheet = %q, want rules of .chroma", css)
+	}
+
+	unknown := DefaultMdOptions
+	unknown.HighlightStyle = "no such style"
+	if err := NewMdRenderer(unknown).WriteHighlightCSS(path); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := ioutil.ReadFile(path); !bytes.Equal(again, css) {
+		t.Error("stylesheet of unknown style differs from the default one")
+	}
+
+	disabled := DefaultMdOptions
+	disabled.Highlight = false
+	if err := NewMdRenderer(disabled).WriteHighlightCSS(path); err != nil {
+		t.Fatal(err)
+	}
+	if FileExist(path) {
+		t.Error("stylesheet is kept after highlighting is disabled")
+	}
+}
+
+func TestMdRendererHighlight(t *testing.T) {
+	source := []byte("```go\nfunc main() {}\n```\n")
+	var buf bytes.Buffer
+	if err := NewMdRenderer(DefaultMdOptions).Markdown().Convert(source, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `class="chroma"`) {
+		t.Errorf("html = %q, want code highlighted with classes", buf.String())
+	}
+}
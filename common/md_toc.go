@@ -0,0 +1,55 @@
+package common
+
+import (
+	"github.com/yuin/goldmark/ast"
+)
+
+// TocItem is a heading in the table of contents of a note.
+type TocItem struct {
+	Title    string
+	ID       string     // Id of the heading, which the item links to with "#" + ID.
+	Children []*TocItem `json:",omitempty"` // Headings of lower level under this one.
+}
+
+// MdToc collect the headings of doc into a table of contents, nested by their levels.
+// Headings without id, which happens if HeadingID is disabled, can not be linked and are left out.
+func MdToc(source []byte, doc ast.Node) []*TocItem {
+	type entry struct {
+		level int
+		item  *TocItem
+	}
+	var toc []*TocItem
+	var stack []entry
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		heading, ok := n.(*ast.Heading)
+		if !ok {
+			return ast.WalkContinue, nil
+		}
+		id, ok := heading.AttributeString("id")
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+		item := &TocItem{Title: MdPlainText(source, heading)}
+		switch v := id.(type) {
+		case []byte:
+			item.ID = string(v)
+		case string:
+			item.ID = v
+		}
+		for len(stack) > 0 && stack[len(stack)-1].level >= heading.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, item)
+		} else {
+			parent := stack[len(stack)-1].item
+			parent.Children = append(parent.Children, item)
+		}
+		stack = append(stack, entry{level: heading.Level, item: item})
+		return ast.WalkSkipChildren, nil
+	})
+	return toc
+}
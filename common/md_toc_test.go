@@ -0,0 +1,73 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/yuin/goldmark/text"
+)
+
+// tocString encode toc into json, so that it can be compared in a line.
+func tocString(toc []*TocItem) string {
+	data, _ := json.Marshal(toc)
+	return string(data)
+}
+
+func TestMdToc(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "no heading",
+			src:  "just text\n",
+			want: "null",
+		},
+		{
+			name: "nested",
+			src:  "# A\n## B\n### C\n## D\n# E\n",
+			want: `[{"Title":"A","ID":"a","Children":[{"Title":"B","ID":"b","Children":[{"Title":"C","ID":"c"}]},{"Title":"D","ID":"d"}]},{"Title":"E","ID":"e"}]`,
+		},
+		{
+			name: "skipped level",
+			src:  "# A\n### B\n## C\n",
+			want: `[{"Title":"A","ID":"a","Children":[{"Title":"B","ID":"b"},{"Title":"C","ID":"c"}]}]`,
+		},
+		{
+			name: "starting at lower level",
+			src:  "### A\n# B\n## C\n",
+			want: `[{"Title":"A","ID":"a"},{"Title":"B","ID":"b","Children":[{"Title":"C","ID":"c"}]}]`,
+		},
+		{
+			name: "inline markup in title",
+			src:  "# Use `go` *now*\n",
+			want: `[{"Title":"Use go now","ID":"use-go-now"}]`,
+		},
+		{
+			name: "duplicate titles",
+			src:  "# A\n# A\n",
+			want: `[{"Title":"A","ID":"a"},{"Title":"A","ID":"a-1"}]`,
+		},
+	}
+	parser := NewMdRenderer(DefaultMdOptions).md.Parser()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte(tt.src)
+			doc := parser.Parse(text.NewReader(src))
+			if got := tocString(MdToc(src, doc)); got != tt.want {
+				t.Errorf("MdToc() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMdTocWithoutHeadingID(t *testing.T) {
+	options := DefaultMdOptions
+	options.HeadingID = false
+	src := []byte("# A\n## B\n")
+	doc := NewMdRenderer(options).md.Parser().Parse(text.NewReader(src))
+	if toc := MdToc(src, doc); toc != nil {
+		t.Errorf("MdToc() = %s, want nil since headings have no id", tocString(toc))
+	}
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+)
+
+// adminTokenSize is the number of random bytes of admin token.
+const adminTokenSize = 32
+
+// NewAdminToken generate a random admin token and write it to filePath,
+// replacing the old one. The file is only readable by owner.
+func NewAdminToken(filePath string) (string, error) {
+	b := make([]byte, adminTokenSize)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	err = ioutil.WriteFile(filePath, []byte(token+"\n"), 0600)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ReadAdminToken read the admin token written by NewAdminToken.
+func ReadAdminToken(filePath string) (string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
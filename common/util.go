@@ -1,13 +1,24 @@
 package common
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log"
 )
 
+var log = logging.Logger("common")
+
 func FileExist(filePath string) bool {
 	info, err := os.Stat(filePath)
 	if err != nil || info.IsDir() {
@@ -26,7 +37,7 @@ func DirectoryExist(dirPath string) bool {
 
 func PathExists(filePath string) bool {
 	_, err := os.Stat(filePath)
-	return err != nil
+	return err == nil
 }
 
 func IsDirEmpty(name string) (bool, error) {
@@ -145,4 +156,93 @@ func CopyDir(src string, dst string) error {
 // Note that newExt should contain ".".
 func ChExt(srcPath string, newExt string) string {
 	return strings.TrimSuffix(srcPath, filepath.Ext(srcPath)) + newExt
-}
\ No newline at end of file
+}
+
+// EscapePath escape each segment of slash separated path p to be used in urls,
+// keeping the slashes between them.
+func EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// HashFile return the hex encoded sha256 of the contents of file filePath.
+func HashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// HashBytes return the hex encoded sha256 of data.
+func HashBytes(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// ExtractFS copy files under root of fsys into directory dst, which would be created if not exists.
+// Existing files would be overwritten.
+func ExtractFS(fsys fs.FS, root string, dst string) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := p
+		if root != "." {
+			rel = strings.TrimPrefix(strings.TrimPrefix(p, path.Clean(root)), "/")
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(target, os.ModePerm)
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, data, 0664)
+	})
+}
+
+// LockTimeout is how long LockFile waits for a lock held by others.
+const LockTimeout = 10 * time.Second
+
+// lockStale is the age after which a lock file is regarded as left by a crashed process.
+const lockStale = time.Minute
+
+// LockFile take the lock lockPath across processes by creating it exclusively.
+// The returned function release the lock.
+// It waits at most LockTimeout for the lock, and breaks locks older than a minute.
+func LockFile(lockPath string) (func(), error) {
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()))
+			f.Close()
+			return func() {
+				_ = os.Remove(lockPath)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > lockStale {
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, &ErrLocked{Path: lockPath}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,74 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "users.lock")
+	unlock, err := LockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !FileExist(lockPath) {
+		t.Fatal("lock file is not created")
+	}
+
+	// Others wait until the lock is released.
+	released := make(chan struct{})
+	first := unlock
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(released)
+		first()
+	}()
+	unlock, err = LockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-released:
+	default:
+		t.Error("lock is taken before released")
+	}
+	unlock()
+	if PathExists(lockPath) {
+		t.Error("lock file is kept after released")
+	}
+
+	// Locks left by crashed processes are broken.
+	if err := os.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * lockStale)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err = LockFile(lockPath)
+	if err != nil {
+		t.Fatal("stale lock is not broken: ", err)
+	}
+	unlock()
+}
+
+func TestEscapePath(t *testing.T) {
+	tests := []struct {
+		p    string
+		want string
+	}{
+		{"a.md", "a.md"},
+		{"dir/b.md", "dir/b.md"},
+		{"my dir/a note.md", "my%20dir/a%20note.md"},
+		{"c#1?.md", "c%231%3F.md"},
+		{"中文.md", "%E4%B8%AD%E6%96%87.md"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := EscapePath(tt.p); got != tt.want {
+			t.Errorf("EscapePath(%q) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
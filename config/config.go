@@ -6,6 +6,7 @@ import (
 	"go-blog/common"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 
 	logging "github.com/ipfs/go-log"
@@ -22,6 +23,26 @@ type Config interface {
 	SetPort(uint16)
 	Resource() string // Return the path of resource directory.
 	SetResource(string)
+	NoteDir() string // Return the path of notes root directory.
+	SetNoteDir(string)
+	CacheDir() string // Return the path of directory where notes are rendered into.
+	SetCacheDir(string)
+	SiteName() string // Return the name of site shown in pages.
+	SetSiteName(string)
+	DevMode() bool // Templates would be reloaded when changed in dev mode.
+	SetDevMode(bool)
+	Theme() string // Return the name of theme in use.
+	SetTheme(string)
+	ControlSocket() string // Return the path of unix socket commands are sent through. Empty if disabled.
+	SetControlSocket(string)
+	NoteStore() string // Return the kind of store note tree is persisted in. Empty for the index file.
+	SetNoteStore(string)
+	// Katex return the url of directory KaTeX is loaded from, such as /res/katex for the one
+	// put in resource directory. Empty for the default CDN.
+	Katex() string
+	SetKatex(string)
+	Markdown() common.MdOptions // Return the options of markdown renderer.
+	SetMarkdown(common.MdOptions)
 	RunningConfig() RunningConfig // Derive an RunningConfig from Config.
 	Reset(string, uint16)
 	WriteBack() error // Write config back to file or database
@@ -32,6 +53,15 @@ type fileConfig struct {
 	HostName   string `json:"host"`
 	PortNumber uint16 `json:"port"`
 	ResDir     string `json:"resource"`
+	NotesDir   string `json:"notes"`
+	CachesDir  string `json:"cache"`
+	Site       string `json:"site"`
+	Dev        bool   `json:"dev"`
+	ThemeName  string `json:"theme"`
+	Control    string `json:"control"`
+	Md         *common.MdOptions `json:"markdown,omitempty"`
+	Store      string `json:"store,omitempty"`
+	KatexUrl   string `json:"katex,omitempty"`
 
 	src    string // file path
 	rwLock sync.Mutex
@@ -67,6 +97,12 @@ func (c *fileConfig) Reset(hostName string, port uint16) {
 	c.HostName = hostName
 	c.PortNumber = port
 	c.ResDir = common.PathResDir()
+	c.NotesDir = common.PathNoteDir()
+	c.CachesDir = common.PathCacheDir()
+	c.Site = common.DEFAULT_SITE_NAME
+	c.ThemeName = common.DEFAULT_THEME
+	md := common.DefaultMdOptions
+	c.Md = &md
 }
 
 func (c *fileConfig) readFromFile(filePath string) error {
@@ -112,11 +148,20 @@ func (c *fileConfig) WriteBack() error {
 }
 
 func (c *fileConfig) RunningConfig() RunningConfig {
-	return &rConfig{
+	rc := &rConfig{
 		host:     c.HostName,
 		port:     c.PortNumber,
-		hostOnly: c.PortNumber != 80,
+		hostOnly: c.PortNumber == 80,
+		resource: c.ResDir,
+		siteName: c.SiteName(),
+		devMode:  c.Dev,
+		control:  c.Control,
+		katex:    c.KatexUrl,
 	}
+	if theme := c.Theme(); theme != common.DEFAULT_THEME {
+		rc.theme = filepath.Join(common.PathThemeDir(), theme)
+	}
+	return rc
 }
 
 func (c *fileConfig) Host() string {
@@ -142,3 +187,96 @@ func (c *fileConfig) SetPort(p uint16) {
 func (c *fileConfig) SetResource(r string) {
 	c.ResDir = r
 }
+
+// NoteDir fall back to the default one for configs written before it was added.
+func (c *fileConfig) NoteDir() string {
+	if c.NotesDir == "" {
+		return common.PathNoteDir()
+	}
+	return c.NotesDir
+}
+
+func (c *fileConfig) SetNoteDir(d string) {
+	c.NotesDir = d
+}
+
+// CacheDir fall back to the default one for configs written before it was added.
+func (c *fileConfig) CacheDir() string {
+	if c.CachesDir == "" {
+		return common.PathCacheDir()
+	}
+	return c.CachesDir
+}
+
+func (c *fileConfig) SetCacheDir(d string) {
+	c.CachesDir = d
+}
+
+func (c *fileConfig) SiteName() string {
+	if c.Site == "" {
+		return common.DEFAULT_SITE_NAME
+	}
+	return c.Site
+}
+
+func (c *fileConfig) SetSiteName(n string) {
+	c.Site = n
+}
+
+func (c *fileConfig) DevMode() bool {
+	return c.Dev
+}
+
+func (c *fileConfig) SetDevMode(d bool) {
+	c.Dev = d
+}
+
+func (c *fileConfig) Theme() string {
+	if c.ThemeName == "" {
+		return common.DEFAULT_THEME
+	}
+	return c.ThemeName
+}
+
+func (c *fileConfig) SetTheme(t string) {
+	c.ThemeName = t
+}
+
+func (c *fileConfig) ControlSocket() string {
+	return c.Control
+}
+
+func (c *fileConfig) SetControlSocket(p string) {
+	c.Control = p
+}
+
+func (c *fileConfig) NoteStore() string {
+	return c.Store
+}
+
+func (c *fileConfig) SetNoteStore(s string) {
+	c.Store = s
+}
+
+func (c *fileConfig) Katex() string {
+	return c.KatexUrl
+}
+
+func (c *fileConfig) SetKatex(u string) {
+	c.KatexUrl = u
+}
+
+func (c *fileConfig) Markdown() common.MdOptions {
+	if c.Md == nil {
+		return common.DefaultMdOptions
+	}
+	md := *c.Md
+	if md.HighlightStyle == "" {
+		md.HighlightStyle = common.DEFAULT_HIGHLIGHT_STYLE
+	}
+	return md
+}
+
+func (c *fileConfig) SetMarkdown(o common.MdOptions) {
+	c.Md = &o
+}
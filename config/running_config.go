@@ -12,6 +12,12 @@ type RunningConfig interface {
 	HostOnly() bool 	 // No port in built url if true.
 	HostOnlyOn()		 // Set HostOnly on
 	HostOnlyOff()		 // Set HostOnly off
+	Resource() string	 // Path of resource directory.
+	SiteName() string	 // Name of site shown in pages.
+	DevMode() bool		 // Templates are reloaded when changed in dev mode.
+	ThemeDir() string	 // Path of theme directory overriding resource directory. Empty for default theme.
+	ControlSocket() string // Path of unix socket listened for commands. Empty if disabled.
+	Katex() string		 // Url of directory KaTeX is loaded from. Empty for the default CDN.
 }
 
 type rConfig struct {
@@ -19,6 +25,12 @@ type rConfig struct {
 	port uint16
 	//requestOutput bool
 	hostOnly bool
+	resource string
+	siteName string
+	devMode  bool
+	theme    string
+	control  string
+	katex    string
 }
 
 func (r *rConfig) Host() string {
@@ -44,4 +56,28 @@ func (r *rConfig) HostOnlyOn() {
 
 func (r *rConfig) HostOnlyOff() {
 	r.hostOnly = false
-}
\ No newline at end of file
+}
+
+func (r *rConfig) Resource() string {
+	return r.resource
+}
+
+func (r *rConfig) SiteName() string {
+	return r.siteName
+}
+
+func (r *rConfig) DevMode() bool {
+	return r.devMode
+}
+
+func (r *rConfig) ThemeDir() string {
+	return r.theme
+}
+
+func (r *rConfig) ControlSocket() string {
+	return r.control
+}
+
+func (r *rConfig) Katex() string {
+	return r.katex
+}
@@ -0,0 +1,9 @@
+// Package resources embeds the default resources, which are templates, css and icons.
+// They are extracted into resource directory by init,
+// and used by server when a file is missing on disk.
+package resources
+
+import "embed"
+
+//go:embed templates css icon
+var FS embed.FS
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/services"
+	"net/http"
+	"strings"
+)
+
+// loginPage is the model of login template, which is a whole page without layout.
+type loginPage struct {
+	Host     string
+	SiteName string
+	From     string // Where to go after login.
+	Account  string
+	Error    string
+}
+
+// newUserStore open the user store in repo directory.
+func newUserStore() services.UserStore {
+	users, err := services.OpenFileUserStore(common.PathUserStore())
+	if err != nil {
+		log.Error("Error when open user store, nobody can login: ", err)
+		return nil
+	}
+	return users
+}
+
+// login show the login page.
+func (s *ginServer) login(c *gin.Context) {
+	if currentUser(c) != nil {
+		c.Redirect(http.StatusFound, s.buildUrl(safeFrom(c.Query("from"))))
+		return
+	}
+	s.renderLogin(c, http.StatusOK, &loginPage{From: c.Query("from")})
+}
+
+// dummyUser is checked against passwords posted for accounts not found.
+// Its hash has the same cost as passwords of users, so that checking it takes as long.
+var dummyUser = &services.User{Hash: "$2a$10$G1iEFguFRSWCy5.Bpd7ZM.MqZJIBB13jRIqp509rkFrF9NOQgMG7G"}
+
+// loginAction check account and password posted from login page,
+// then set session and redirect back to where the user came from.
+func (s *ginServer) loginAction(c *gin.Context) {
+	account := strings.TrimSpace(c.PostForm("account"))
+	password := c.PostForm("password")
+	from := c.PostForm("from")
+	p := &loginPage{From: from, Account: account}
+	if s.users == nil || s.sessionKey == nil {
+		p.Error = "登录暂不可用"
+		s.renderLogin(c, http.StatusServiceUnavailable, p)
+		return
+	}
+
+	user, err := s.users.Get(account)
+	if err != nil {
+		log.Error("Error when get user ", account, ": ", err)
+		p.Error = "登录暂不可用"
+		s.renderLogin(c, http.StatusInternalServerError, p)
+		return
+	}
+	if user == nil {
+		// Check the password anyway, so that the time taken does not tell whether the account exists.
+		_ = dummyUser.CheckPassword(password)
+	}
+	if user == nil || !user.CheckPassword(password) {
+		log.Warn("Failed login of ", account, " from ", c.ClientIP())
+		p.Error = "用户或暗号不对"
+		s.renderLogin(c, http.StatusUnauthorized, p)
+		return
+	}
+	s.setSession(c, user)
+	c.Redirect(http.StatusSeeOther, s.buildUrl(safeFrom(from)))
+}
+
+// logout clear the session and go to home page.
+// It only accepts POST so that other sites can not log users out by links.
+func (s *ginServer) logout(c *gin.Context) {
+	s.clearSession(c)
+	c.Redirect(http.StatusSeeOther, s.buildUrl("/home"))
+}
+
+// admin show the admin page.
+func (s *ginServer) admin(c *gin.Context) {
+	users, err := s.users.List()
+	if err != nil {
+		log.Error("Error when list users: ", err)
+	}
+	s.renderPage(c, http.StatusOK, "admin", "管理", gin.H{
+		"Users": users,
+	})
+}
+
+func (s *ginServer) renderLogin(c *gin.Context, code int, p *loginPage) {
+	if s.templates == nil {
+		c.String(http.StatusInternalServerError, "Templates are not loaded.")
+		return
+	}
+	p.Host = s.buildUrl("")
+	p.SiteName = s.cfg.SiteName()
+	var buf bytes.Buffer
+	err := s.templates.execute(&buf, "login", p)
+	if err != nil {
+		log.Error("Error when execute template login: ", err)
+		c.String(http.StatusInternalServerError, "Error when render page.")
+		return
+	}
+	c.Data(code, "text/html; charset=utf-8", buf.Bytes())
+}
+
+// safeFrom return from if it is a path of this site, otherwise the home page,
+// so that login can not be used to redirect to other sites.
+func safeFrom(from string) string {
+	if !strings.HasPrefix(from, "/") || strings.HasPrefix(from, "//") || strings.HasPrefix(from, "/\\") {
+		return "/home"
+	}
+	return from
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"go-blog/services"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSafeFrom(t *testing.T) {
+	tests := []struct {
+		from string
+		want string
+	}{
+		{"", "/home"},
+		{"/", "/"},
+		{"/notes/a.md?x=1#top", "/notes/a.md?x=1#top"},
+		{"notes/a.md", "/home"},
+		{"https://evil.example.com/", "/home"},
+		{"//evil.example.com/", "/home"},
+		{"/\\evil.example.com/", "/home"},
+		{"javascript:alert(1)", "/home"},
+	}
+	for _, tt := range tests {
+		if got := safeFrom(tt.from); got != tt.want {
+			t.Errorf("safeFrom(%q) = %q, want %q", tt.from, got, tt.want)
+		}
+	}
+}
+
+// addUser add a user with password and role to the user store of s.
+func addUser(t *testing.T, s *ginServer, name string, password string, role string) *services.User {
+	user := &services.User{Name: name, Role: role}
+	if err := user.SetPassword(password); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.users.Put(user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// postLogin post account and password to the login action of s.
+func postLogin(s *ginServer, account string, password string, from string) *httptest.ResponseRecorder {
+	form := url.Values{"account": {account}, "password": {password}, "from": {from}}
+	req := httptest.NewRequest(http.MethodPost, "/login_action", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(s, req)
+}
+
+func TestLoginAction(t *testing.T) {
+	s := newTestServer(t, nil)
+	addUser(t, s, "alice", "secret", services.RoleAdmin)
+	tests := []struct {
+		name     string
+		account  string
+		password string
+		code     int
+	}{
+		{"wrong password", "alice", "guess", http.StatusUnauthorized},
+		{"unknown user", "bob", "secret", http.StatusUnauthorized},
+		{"empty", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postLogin(s, tt.account, tt.password, "/admin")
+			if w.Code != tt.code || len(w.Result().Cookies()) != 0 {
+				t.Errorf("status = %d with cookies %v, want %d without session", w.Code, w.Result().Cookies(), tt.code)
+			}
+		})
+	}
+
+	w := postLogin(s, " alice ", "secret", "/admin")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "http://127.0.0.1:8080/admin" {
+		t.Fatalf("status = %d to %q, want redirected back to /admin", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %v, want an http only session cookie", cookies)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.AddCookie(cookies[0])
+	if w := serve(s, req); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("status of /admin with session = %d, want admin page", w.Code)
+	}
+
+	// Login page sends users logged in back.
+	req = httptest.NewRequest(http.MethodGet, "/login?from=//evil.example.com/", nil)
+	req.AddCookie(cookies[0])
+	if w := serve(s, req); w.Header().Get("Location") != "http://127.0.0.1:8080/home" {
+		t.Errorf("login page redirect logged in user to %q, want home", w.Header().Get("Location"))
+	}
+}
+
+func TestDummyUser(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyUser.Hash))
+	if err != nil || cost != bcrypt.DefaultCost {
+		t.Errorf("cost of dummy hash = %d, %v, want %d", cost, err, bcrypt.DefaultCost)
+	}
+	if dummyUser.CheckPassword("") {
+		t.Error("empty password matches dummy hash")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t, nil)
+	addUser(t, s, "alice", "secret", services.RoleReader)
+	session := postLogin(s, "alice", "secret", "/home").Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.AddCookie(session)
+	if w := serve(s, req); w.Code != http.StatusNotFound || len(w.Result().Cookies()) != 0 {
+		t.Errorf("GET /logout = %d with cookies %v, want 404 keeping session", w.Code, w.Result().Cookies())
+	}
+	if w := serve(s, sessionRequest("/home", session.Value)); !strings.Contains(w.Body.String(), `action="http://127.0.0.1:8080/logout"`) {
+		t.Error("side bar of user logged in has no logout form")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(session)
+	w := serve(s, req)
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusSeeOther || len(cookies) != 1 || cookies[0].Name != sessionCookie || cookies[0].MaxAge >= 0 {
+		t.Errorf("POST /logout = %d with cookies %v, want session cleared", w.Code, cookies)
+	}
+}
@@ -1,12 +1,47 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// homePageSize is the number of recent notes in a page of home.
+const homePageSize = 10
 
 func (s *ginServer) root(c *gin.Context) {
 	url := s.buildUrl("/home")
 	redirect(c, url)
 }
 
+// home show pinned notes and recent notes paginated by query "page", which starts from 1.
 func (s *ginServer) home(c *gin.Context) {
+	pageNum, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+	role := viewerRole(c)
+	// Clamp page to existing ones first, so that a huge page would not overflow the offset.
+	_, total := s.notes.RecentNotes(0, 0, role)
+	pageCount := (total + homePageSize - 1) / homePageSize
+	if pageNum > pageCount && pageCount > 0 {
+		pageNum = pageCount
+	}
+	recent, _ := s.notes.RecentNotes((pageNum-1)*homePageSize, homePageSize, role)
 
-}
\ No newline at end of file
+	data := gin.H{
+		"Recent":    recent,
+		"Page":      pageNum,
+		"PageCount": pageCount,
+	}
+	if pageNum == 1 {
+		data["Pinned"] = s.notes.PinnedNotes(role)
+	}
+	if pageNum > 1 {
+		data["PrevPage"] = pageNum - 1
+	}
+	if pageNum < pageCount {
+		data["NextPage"] = pageNum + 1
+	}
+	s.renderPage(c, http.StatusOK, "home", "首页", data)
+}
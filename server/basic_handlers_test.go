@@ -0,0 +1,46 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHome(t *testing.T) {
+	files := map[string]string{
+		"pinned.md": "---\ntitle: Pinned note\npinned: true\ndate: 2021-01-01\n---\nPinned.\n",
+		"draft.md":  "---\ntitle: Draft note\ndraft: true\ndate: 2021-12-01\n---\nDraft.\n",
+	}
+	// 12 notes fill a page and a half, note-00 is the newest.
+	for i := 0; i < 12; i++ {
+		files[fmt.Sprintf("n%02d.md", i)] = fmt.Sprintf("---\ntitle: note-%02d\ndate: 2021-06-%02d\n---\nText.\n", i, 28-i)
+	}
+	s := newTestServer(t, files)
+	tests := []struct {
+		target string
+		want   []string
+		absent []string
+	}{
+		{"/home", []string{"Pinned note", "note-00", "note-09", "1 / 2", "page=2"}, []string{"note-10", "Draft note"}},
+		{"/home?page=2", []string{"note-10", "note-11", "2 / 2", "page=1"}, []string{"Pinned note", "note-09"}},
+		{"/home?page=0", []string{"Pinned note", "note-00", "1 / 2"}, []string{"note-10"}},
+		{"/home?page=x", []string{"Pinned note", "note-00", "1 / 2"}, []string{"note-10"}},
+		{"/home?page=99", []string{"note-10", "note-11", "2 / 2"}, []string{"Pinned note", "note-09"}},
+		{"/home?page=9223372036854775807", []string{"note-10", "2 / 2"}, []string{"note-09"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			body := get(s, tt.target).Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q", want)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(body, absent) {
+					t.Errorf("body contains %q", absent)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"go-blog/common"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// controlConnKey marks the context of requests from control socket.
+type controlConnKey struct{}
+
+// loadAdminToken read the admin token in repo, or generate one if there is none,
+// for repos initialized before tokens were introduced.
+func loadAdminToken() string {
+	token, err := common.ReadAdminToken(common.PathAdminToken())
+	if err == nil && token != "" {
+		return token
+	}
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("Error when read admin token, commands would be refused: ", err)
+		return ""
+	}
+	token, err = common.NewAdminToken(common.PathAdminToken())
+	if err != nil {
+		log.Error("Error when generate admin token, commands would be refused: ", err)
+		return ""
+	}
+	log.Info("Admin token generated in ", common.PathAdminToken())
+	return token
+}
+
+// assertAdmin middleware is used before any request from command line.
+// Such requests must carry the admin token as "Authorization: Bearer <token>",
+// and come from control socket or loopback address.
+func (s *ginServer) assertAdmin(c *gin.Context) {
+	if !isControlRequest(c.Request) && !isLoopback(c.Request.RemoteAddr) {
+		log.Warn("Receive an request not allowed for host other than localhost from ",
+			c.Request.RemoteAddr, ": ", c.Request.Method, " - ", c.Request.RequestURI)
+		c.String(http.StatusForbidden, "This request is only allowed for localhost.")
+		c.Abort()
+		return
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if s.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		log.Warn("Receive an request with wrong admin token: ", c.Request.Method, " - ", c.Request.RequestURI)
+		c.String(http.StatusUnauthorized, "Wrong admin token.")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func isControlRequest(r *http.Request) bool {
+	v, _ := r.Context().Value(controlConnKey{}).(bool)
+	return v
+}
+
+// isLoopback report whether remote address, such as 127.0.0.1:1234 or [::1]:1234, is a loopback address.
+func isLoopback(remote string) bool {
+	host, _, err := net.SplitHostPort(remote)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// startControl listen on control socket if it is configured.
+// The socket is only accessible by owner of repo.
+// It is started and stopped by Run along with the http server.
+func (s *ginServer) startControl() {
+	sock := s.cfg.ControlSocket()
+	if sock == "" {
+		return
+	}
+	// Remove the socket left by last run, which would make listen fail.
+	if common.PathExists(sock) {
+		_ = os.Remove(sock)
+	}
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		log.Error("Error when listen on control socket: ", err)
+		return
+	}
+	err = os.Chmod(sock, 0600)
+	if err != nil {
+		log.Error("Error when chmod control socket: ", err)
+		l.Close()
+		return
+	}
+	s.control = &http.Server{
+		Handler: s.router,
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, controlConnKey{}, true)
+		},
+	}
+	s.wg.Add(1)
+	go func(srv *http.Server) {
+		defer s.wg.Done()
+		err := srv.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			log.Error("Error when serve control socket: ", err)
+		}
+	}(s.control)
+}
+
+// stopControl stop serving control socket if it is served.
+func (s *ginServer) stopControl() {
+	if s.control == nil {
+		return
+	}
+	err := s.control.Shutdown(s.ctx)
+	if err != nil {
+		log.Error("Error when shutdown control socket: ", err)
+	}
+	s.control = nil
+}
+
+// shutdown stop the server and control socket.
+func (s *ginServer) shutdown() error {
+	s.stopControl()
+	return s.server.Shutdown(s.ctx)
+}
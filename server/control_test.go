@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"go-blog/config"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsLoopback(t *testing.T) {
+	tests := []struct {
+		remote string
+		want   bool
+	}{
+		{"127.0.0.1:1234", true},
+		{"127.0.0.2:1234", true},
+		{"[::1]:1234", true},
+		{"192.168.1.2:1234", false},
+		{"[2001:db8::1]:1234", false},
+		{"127.0.0.1", false},
+		{"localhost:1234", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopback(tt.remote); got != tt.want {
+			t.Errorf("isLoopback(%q) = %v, want %v", tt.remote, got, tt.want)
+		}
+	}
+}
+
+func TestAssertAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		token   string // Admin token of server.
+		remote  string
+		control bool // Whether the request is from control socket.
+		auth    string
+		want    int
+	}{
+		{"loopback with token", "secret", "127.0.0.1:1234", false, "Bearer secret", http.StatusOK},
+		{"ipv6 loopback with token", "secret", "[::1]:1234", false, "Bearer secret", http.StatusOK},
+		{"control socket with token", "secret", "@", true, "Bearer secret", http.StatusOK},
+		{"remote with token", "secret", "10.0.0.1:1234", false, "Bearer secret", http.StatusForbidden},
+		{"no token", "secret", "127.0.0.1:1234", false, "", http.StatusUnauthorized},
+		{"wrong token", "secret", "127.0.0.1:1234", false, "Bearer guess", http.StatusUnauthorized},
+		{"token prefix", "secret", "127.0.0.1:1234", false, "Bearer sec", http.StatusUnauthorized},
+		{"server without token", "", "127.0.0.1:1234", false, "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &ginServer{adminToken: tt.token}
+			r := gin.New()
+			r.GET("/cmd", s.assertAdmin, func(c *gin.Context) {
+				c.String(http.StatusOK, "ok")
+			})
+			req := httptest.NewRequest(http.MethodGet, "/cmd", nil)
+			req.RemoteAddr = tt.remote
+			if tt.control {
+				req = req.WithContext(context.WithValue(req.Context(), controlConnKey{}, true))
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+// newControlServer create a server listening on port, with control socket in a temporary directory.
+func newControlServer(t *testing.T, port uint16) (*ginServer, string) {
+	sock := filepath.Join(t.TempDir(), "control.sock")
+	s := newTestServerWith(t, nil, func(cfg config.Config) {
+		cfg.SetPort(port)
+		cfg.SetControlSocket(sock)
+	})
+	s.adminToken = "token"
+	return s, sock
+}
+
+// waitDone wait for s.wg, failing t if goroutines of s do not end in time.
+func waitDone(t *testing.T, s *ginServer) {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("goroutines of server do not end")
+	}
+}
+
+func TestControlSocket(t *testing.T) {
+	s, sock := newControlServer(t, 8080)
+	s.startControl()
+	if info, err := os.Stat(sock); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("stat of control socket = %v, %v, want mode 0600", info, err)
+	}
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return net.Dial("unix", sock)
+		},
+	}}
+	resp, err := client.Post("http://control/cmd/markdown/render", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// Requests from control socket are allowed without loopback address, but still need the token.
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status of command without token = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	s.stopControl()
+	waitDone(t, s)
+	if s.control != nil {
+		t.Error("control server is kept after stopped")
+	}
+	if _, err := net.Dial("unix", sock); err == nil {
+		t.Error("control socket is still listened after stopped")
+	}
+}
+
+func TestRunStopsControlOnError(t *testing.T) {
+	// The port is taken, so the http server fails to start.
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s, sock := newControlServer(t, uint16(l.Addr().(*net.TCPAddr).Port))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Run()
+	}()
+	s.Start()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Error("Run() = nil, want error of listening on port taken")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() does not return after the http server failed")
+	}
+	if _, err := net.Dial("unix", sock); err == nil {
+		t.Error("control socket is still listened after Run returned")
+	}
+}
@@ -1,7 +1,90 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/services"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
 
+// renderResult is the json response of renderMd.
+type renderResult struct {
+	Path  string                 `json:"path"`
+	Note  *services.NoteTreeNode `json:"note,omitempty"`
+	Error string                 `json:"error,omitempty"`
+}
+
+// renderMd render a note through note service, so that the tree and cache of running server are updated.
+// The note is given by form value "path", relative to notes root or absolute inside it.
+// Note that a path like "/a.md" is regarded as relative to notes root unless it is inside it.
+// Markdown can also be uploaded by form value "content" or multipart file "file",
+// which would be saved to "path" (name of the uploaded file by default) before rendered.
 func (s *ginServer) renderMd(c *gin.Context) {
+	target := c.PostForm("path")
+	content, hasContent := c.GetPostForm("content")
+	file, fileErr := c.FormFile("file")
+	hasFile := fileErr == nil
+	if hasFile && target == "" {
+		target = file.Filename
+	}
+
+	root := s.notes.FetchAll().RawPath
+	relative, err := notesRelative(root, target)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, renderResult{Path: target, Error: err.Error()})
+		return
+	}
+
+	if hasContent || hasFile {
+		if filepath.Ext(relative) != ".md" {
+			c.JSON(http.StatusBadRequest, renderResult{Path: relative, Error: relative + " is not a markdown file"})
+			return
+		}
+		dst := filepath.Join(root, filepath.FromSlash(relative))
+		err = os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+		if err == nil {
+			if hasContent {
+				err = ioutil.WriteFile(dst, []byte(content), 0644)
+			} else {
+				err = c.SaveUploadedFile(file, dst)
+			}
+		}
+		if err != nil {
+			log.Error("Error when save uploaded markdown: ", err)
+			c.JSON(http.StatusInternalServerError, renderResult{Path: relative, Error: err.Error()})
+			return
+		}
+	}
+
+	node, err := s.notes.Render(relative)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if _, ok := err.(*common.ErrNoSuchNode); ok {
+			code = http.StatusNotFound
+		}
+		c.JSON(code, renderResult{Path: relative, Note: node, Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, renderResult{Path: relative, Note: node})
+}
 
+// notesRelative convert target to a path relative to notes root in form of "/a/b.md".
+// Absolute target inside root is converted, others are regarded as relative to root.
+func notesRelative(root string, target string) (string, error) {
+	if target == "" {
+		return "", errors.New("no path given")
+	}
+	if filepath.IsAbs(target) {
+		rel, err := filepath.Rel(root, target)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			target = rel
+		}
+	}
+	return path.Clean("/" + filepath.ToSlash(target)), nil
 }
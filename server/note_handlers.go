@@ -0,0 +1,128 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/services"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// noteEntry is a child of directory in index listing.
+type noteEntry struct {
+	Path string
+	Note *services.NoteTreeNode
+}
+
+// note serve the note or directory with relative path.
+// Files copied to cache directory along with notes, such as images, are served as they are.
+func (s *ginServer) note(c *gin.Context) {
+	relative := path.Clean("/" + c.Param("path"))
+	visibility := s.notes.Visibility(relative)
+	if !services.CanView(visibility, viewerRole(c)) {
+		s.denyNote(c, relative, visibility)
+		return
+	}
+	node := s.notes.Fetch(relative, true)
+	if node == nil {
+		s.cachedFile(c, relative)
+		return
+	}
+
+	if node.IsDir {
+		s.noteDir(c, relative, node, visibility)
+		return
+	}
+
+	content, err := ioutil.ReadFile(node.RenderedPath)
+	if err != nil {
+		log.Error("Error when read rendered note ", node.RenderedPath, ": ", err)
+		c.String(http.StatusInternalServerError, "Error when read note.")
+		return
+	}
+	p := s.newPage(c, node.Title(), gin.H{
+		"Path":    relative,
+		"Note":    node,
+		"Content": template.HTML(content),
+	})
+	p.Toc = node.Toc
+	s.executePage(c, http.StatusOK, "note", p)
+}
+
+// cachedFile serve the file with relative path in cache directory, which is not a note.
+// Rendered html of a note is served only if the note can be seen by current user,
+// and it is taken as not found otherwise, so that its existence is not exposed.
+func (s *ginServer) cachedFile(c *gin.Context, relative string) {
+	if path.Ext(relative) == ".html" {
+		source := common.ChExt(relative, ".md")
+		if s.notes.Fetch(source, true) != nil && !services.CanView(s.notes.Visibility(source), viewerRole(c)) {
+			s.notFound(c, &common.ErrNoSuchNode{Relative: relative})
+			return
+		}
+	}
+	cached := filepath.Join(s.notes.FetchAll().RenderedPath, filepath.FromSlash(relative))
+	if !common.FileExist(cached) {
+		s.notFound(c, &common.ErrNoSuchNode{Relative: relative})
+		return
+	}
+	c.File(cached)
+}
+
+// noteDir render the index listing of directory node with visibility, directories first.
+// Only entries listed for current user are shown.
+func (s *ginServer) noteDir(c *gin.Context, relative string, node *services.NoteTreeNode, visibility string) {
+	role := viewerRole(c)
+	entries := make([]noteEntry, 0, len(node.Links))
+	for name, child := range node.Links {
+		if !services.IsListed(services.InheritVisibility(child.OwnVisibility(), visibility), role) {
+			continue
+		}
+		entries = append(entries, noteEntry{
+			Path: path.Join(relative, name),
+			Note: child,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Note.IsDir != entries[j].Note.IsDir {
+			return entries[i].Note.IsDir
+		}
+		return entries[i].Note.Name < entries[j].Note.Name
+	})
+
+	var parent string
+	if relative != "/" {
+		parent = path.Dir(relative)
+	}
+	title := relative
+	if relative == "/" {
+		title = "笔记"
+	}
+	s.renderPage(c, http.StatusOK, "note_dir", title, gin.H{
+		"Path":    relative,
+		"Parent":  parent,
+		"Entries": entries,
+	})
+}
+
+// denyNote refuse to show the note with relative path to current user.
+// Visitors are asked to login for notes of logged-in users,
+// while others get 404 so that the existence of the note is not revealed.
+func (s *ginServer) denyNote(c *gin.Context, relative string, visibility string) {
+	if visibility == services.VisibilityLoggedIn && currentUser(c) == nil {
+		c.Redirect(http.StatusFound, s.buildUrl("/login")+"?from="+url.QueryEscape(c.Request.URL.RequestURI()))
+		return
+	}
+	s.notFound(c, &common.ErrNoSuchNode{Relative: relative})
+}
+
+// notFound render the 404 page with err.
+func (s *ginServer) notFound(c *gin.Context, err error) {
+	s.renderPage(c, http.StatusNotFound, "not_found", "找不到", gin.H{
+		"Error": err.Error(),
+	})
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"go-blog/config"
+	"go-blog/services"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeNotes(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"a.md":          "# Alpha\n\nFirst note, see [Beta](dir/b.md) and [[my note]].\n",
+		"dir/b.md":      "# Beta\n",
+		"my note.md":    "# Mine\n",
+		"dir/sub/.keep": "",
+		"dir/img.txt":   "not a note",
+	})
+	tests := []struct {
+		target string
+		code   int
+		want   []string // Strings expected in body.
+	}{
+		{"/notes/a.md", http.StatusOK, []string{`<h1 id="alpha">Alpha</h1>`, "First note",
+			`href="http://127.0.0.1:8080/notes/dir/b.md"`, `href="http://127.0.0.1:8080/notes/my%20note.md"`}},
+		{"/notes/dir", http.StatusOK, []string{"sub", "b.md"}},
+		{"/notes", http.StatusOK, []string{"dir", "a.md"}},
+		{"/notes/dir/img.txt", http.StatusOK, []string{"not a note"}},
+		{"/notes/dir/../a.md", http.StatusOK, []string{`<h1 id="alpha">Alpha</h1>`}},
+		{"/notes/missing.md", http.StatusNotFound, []string{"missing.md"}},
+		{"/no/such/page", http.StatusNotFound, []string{"/no/such/page"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := get(s, tt.target)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			body := w.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q:\n%s", want, body)
+				}
+			}
+		})
+	}
+
+	// Directories are listed before notes.
+	body := get(s, "/notes/dir").Body.String()
+	if strings.Index(body, "sub") > strings.Index(body, "b.md") {
+		t.Error("directory sub is not listed before note b.md")
+	}
+}
+
+func TestNoteVisibilityByRole(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"pub.md":             "# Pub\n",
+		"hidden.md":          "---\nvisibility: unlisted\n---\n# Hidden\n",
+		"members.md":         "---\nvisibility: logged-in\n---\n# Members\n",
+		"draft.md":           "---\ndraft: true\n---\n# Draft\n",
+		"priv/.settings.yml": "visibility: private\n",
+		"priv/a.md":          "# Private\n",
+	})
+	sessions := map[string]string{"": ""}
+	for _, role := range []string{services.RoleReader, services.RoleEditor, services.RoleAdmin} {
+		user := addUser(t, s, role, "secret", role)
+		sessions[role] = s.signSession(user, time.Now().Add(time.Hour))
+	}
+	// Status of each target for visitors, readers, editors and admins.
+	tests := []struct {
+		target string
+		codes  [4]int
+	}{
+		{"/notes/pub.md", [4]int{200, 200, 200, 200}},
+		{"/notes/hidden.md", [4]int{200, 200, 200, 200}},
+		{"/notes/members.md", [4]int{302, 200, 200, 200}},
+		{"/notes/draft.md", [4]int{404, 404, 200, 200}},
+		{"/notes/draft.html", [4]int{404, 404, 200, 200}},
+		{"/notes/members.html", [4]int{404, 200, 200, 200}},
+		{"/notes/priv", [4]int{404, 404, 404, 200}},
+		{"/notes/priv/a.md", [4]int{404, 404, 404, 200}},
+		{"/notes/priv/a.html", [4]int{404, 404, 404, 200}},
+	}
+	roles := []string{"", services.RoleReader, services.RoleEditor, services.RoleAdmin}
+	for _, tt := range tests {
+		for i, role := range roles {
+			w := serve(s, sessionRequest(tt.target, sessions[role]))
+			if w.Code != tt.codes[i] {
+				t.Errorf("status of %s for role %q = %d, want %d", tt.target, role, w.Code, tt.codes[i])
+			}
+		}
+	}
+
+	// Listing only shows notes listed for the viewer.
+	listed := map[string][]bool{ // Whether each note is listed for each of roles.
+		"pub.md":     {true, true, true, true},
+		"hidden.md":  {false, false, false, false},
+		"members.md": {false, true, true, true},
+		"draft.md":   {false, false, true, true},
+		"priv":       {false, false, false, true},
+	}
+	for i, role := range roles {
+		body := serve(s, sessionRequest("/notes", sessions[role])).Body.String()
+		for name, want := range listed {
+			if got := strings.Contains(body, "/notes/"+name+`"`); got != want[i] {
+				t.Errorf("%s listed for role %q = %v, want %v", name, role, got, want[i])
+			}
+		}
+	}
+}
+
+func TestNoteKatex(t *testing.T) {
+	files := map[string]string{
+		"math.md":  "Euler: $e^{i\\pi} + 1 = 0$\n",
+		"plain.md": "No math.\n",
+	}
+	tests := []struct {
+		name   string
+		katex  string
+		want   []string
+		absent []string
+	}{
+		{"default CDN", "", []string{defaultKatex.Url + "/katex.min.js", `integrity="` + defaultKatex.JS + `"`}, nil},
+		{"site directory", "/res/katex/", []string{`src="http://127.0.0.1:8080/res/katex/katex.min.js"`}, []string{"integrity="}},
+		{"other url", "https://example.com/katex", []string{`src="https://example.com/katex/katex.min.js"`}, []string{"integrity="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServerWith(t, files, func(cfg config.Config) {
+				cfg.SetKatex(tt.katex)
+			})
+			body := get(s, "/notes/math.md").Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q", want)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(body, absent) {
+					t.Errorf("body contains %q", absent)
+				}
+			}
+			if body := get(s, "/notes/plain.md").Body.String(); strings.Contains(body, "katex.min.js") {
+				t.Error("KaTeX is loaded for note without math")
+			}
+		})
+	}
+}
+
+func TestBrokenFrontMatterHidden(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"broken.md": "---\nvisibility: [public\n---\nSecret.\n",
+	})
+	if w := get(s, "/notes/broken.md"); w.Code != http.StatusNotFound {
+		t.Errorf("status of note failing to render = %d, want 404", w.Code)
+	}
+	if w := get(s, "/notes/"); strings.Contains(w.Body.String(), "broken.md") {
+		t.Error("note failing to render is listed")
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/resources"
+	"go-blog/services"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// page is the model every page template is executed with.
+type page struct {
+	Host     string // Prefix of urls, such as http://127.0.0.1:8080
+	Title    string
+	SiteName string
+	User     *services.User // nil if not logged in.
+	Nav      []navItem
+	Data     interface{}       // Data of the content template.
+	Toc      []*common.TocItem // Outline of the note shown in side bar. nil for other pages.
+	Katex    katexSource       // Where KaTeX is loaded from for notes with math.
+	Content  template.HTML     // Result of the content template, embedded by layout.
+}
+
+// katexSource is the directory KaTeX is loaded from, with the subresource integrity of its files,
+// which is only checked for the default CDN since other copies may be of other versions.
+type katexSource struct {
+	Url        string
+	CSS        string // Integrity of katex.min.css. Empty if not checked.
+	JS         string // Integrity of katex.min.js. Empty if not checked.
+	AutoRender string // Integrity of contrib/auto-render.min.js. Empty if not checked.
+}
+
+// defaultKatex is KaTeX on CDN, used unless another directory is configured.
+var defaultKatex = katexSource{
+	Url:        "https://cdn.jsdelivr.net/npm/katex@0.13.11/dist",
+	CSS:        "sha384-Um5gpz1odJg5Z4HAmzPtgZKdTBHZdw8S29IecapCSB31ligYPhHQZMIlWLYQGVoc",
+	JS:         "sha384-YNHdsYkH6gMx9y3mRkmcJ2mFUjTd0qNQQvY9VYZgQd7DcN7env35GzlmFaZ23JGp",
+	AutoRender: "sha384-vZTG03m+2yp6N6BNi5iM4rW4oIwk5DfcNdFfxkk9ZWpDriOkXX8voJBFrAO7MpVl",
+}
+
+// katex return where KaTeX is loaded from by config.
+// Paths starting with "/" are taken as urls of this site, such as /res/katex.
+func (s *ginServer) katex() katexSource {
+	u := strings.TrimSuffix(s.cfg.Katex(), "/")
+	if u == "" {
+		return defaultKatex
+	}
+	if strings.HasPrefix(u, "/") {
+		u = s.buildUrl(u)
+	}
+	return katexSource{Url: u}
+}
+
+// navItem is an entry of the navigation bar.
+type navItem struct {
+	Name   string
+	Url    string
+	Active bool // Whether the current page is under this entry.
+}
+
+// navEntries are the entries of navigation bar, as name and relative path.
+var navEntries = [][2]string{
+	{"首页", "/home"},
+	{"笔记", "/notes"},
+	{"标签", "/tags"},
+	{"搜索", "/search"},
+}
+
+// loadTemplates parse all templates embedded, in resource directory and in theme directory.
+func (s *ginServer) loadTemplates() error {
+	var dirs []string
+	for _, dir := range s.resourceDirs() {
+		// Templates are loaded in reverse so that theme overrides resource.
+		dirs = append([]string{filepath.Join(dir, "templates")}, dirs...)
+	}
+	t, err := newTemplateSet(resources.FS, dirs, s.cfg.DevMode())
+	if err != nil {
+		return err
+	}
+	s.templates = t
+	return nil
+}
+
+// newPage create the page model for request c.
+func (s *ginServer) newPage(c *gin.Context, title string, data interface{}) *page {
+	p := &page{
+		Host:     s.buildUrl(""),
+		Title:    title,
+		SiteName: s.cfg.SiteName(),
+		User:     currentUser(c),
+		Data:     data,
+		Katex:    s.katex(),
+	}
+	for _, entry := range navEntries {
+		p.Nav = append(p.Nav, navItem{
+			Name:   entry[0],
+			Url:    s.buildUrl(entry[1]),
+			Active: strings.HasPrefix(c.Request.URL.Path, entry[1]),
+		})
+	}
+	return p
+}
+
+// renderPage execute template content with data, then embed the result into layout.
+func (s *ginServer) renderPage(c *gin.Context, code int, content string, title string, data interface{}) {
+	s.executePage(c, code, content, s.newPage(c, title, data))
+}
+
+// executePage execute template content with page model p, then embed the result into layout.
+func (s *ginServer) executePage(c *gin.Context, code int, content string, p *page) {
+	if s.templates == nil {
+		c.String(http.StatusInternalServerError, "Templates are not loaded.")
+		return
+	}
+	var buf bytes.Buffer
+	err := s.templates.execute(&buf, content, p)
+	if err != nil {
+		log.Error("Error when execute template ", content, ": ", err)
+		c.String(http.StatusInternalServerError, "Error when render page.")
+		return
+	}
+	p.Content = template.HTML(buf.String())
+
+	buf.Reset()
+	err = s.templates.execute(&buf, "layout", p)
+	if err != nil {
+		log.Error("Error when execute template layout: ", err)
+		c.String(http.StatusInternalServerError, "Error when render page.")
+		return
+	}
+	c.Data(code, "text/html; charset=utf-8", buf.Bytes())
+}
@@ -1,9 +1,10 @@
 package server
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"go-blog/services"
 	"net/http"
-	"strings"
 )
 
 func (s *ginServer) initRouter() {
@@ -15,11 +16,38 @@ func (s *ginServer) initRouter() {
 	if s.cfg.RequestOutput() {
 		s.router.Use(outPutInfo)
 	}
+	s.router.Use(s.loadUser)
+
+	err := s.loadTemplates()
+	if err != nil {
+		log.Error("Error when load templates: ", err)
+	}
 
 	s.router.GET("", s.root)
 	s.router.GET("/home", s.home)
+	s.router.GET("/tags", s.tags)
+	s.router.GET("/tags/:tag", s.tag)
+	s.router.GET("/categories/:category", s.category)
+	s.router.GET("/search", s.search)
+	s.router.GET("/notes", s.note)
+	s.router.GET("/notes/*path", s.note)
+	s.router.GET("/res/*path", s.resource)
+	s.router.HEAD("/res/*path", s.resource)
+	s.router.GET("/favicon.ico", s.favicon)
+	s.router.HEAD("/favicon.ico", s.favicon)
+	s.router.GET("/login", s.login)
+	s.router.POST("/login_action", s.loginAction)
+	s.router.POST("/logout", s.logout)
+	s.router.NoRoute(func(c *gin.Context) {
+		s.notFound(c, errors.New("no such page: "+c.Request.URL.Path))
+	})
+
+	adminGroup := s.router.Group("/admin", s.requireRole(services.RoleAdmin))
+	{
+		adminGroup.GET("", s.admin)
+	}
 
-	cmdGroup := s.router.Group("/cmd", assertLocalhost)
+	cmdGroup := s.router.Group("/cmd", s.assertAdmin)
 	{
 		cmdGroup.POST("markdown/render", s.renderMd)
 	}
@@ -35,17 +63,3 @@ func redirect(g *gin.Context, url string) {
 	log.Debug("redirect to: ", url)
 	g.Redirect(http.StatusMovedPermanently, url)
 }
-
-// assertLocalhost middleware is used before any request that only allow localhost.
-// Such requests are from command line most times.
-func assertLocalhost(c *gin.Context) {
-	remote := strings.Split(c.Request.RemoteAddr, ":")[0]
-	if remote == "127.0.0.1" {
-		c.Next()
-	} else {
-		log.Warn("Receive an request not allowed for host other than localhost from ",
-			remote, ": ", c.Request.Method, " - ", c.Request.RequestURI)
-		c.String(http.StatusBadRequest, "This request is only allowed for localhost.")
-		c.Abort()
-	}
-}
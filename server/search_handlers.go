@@ -0,0 +1,50 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-blog/services"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// searchLimit is the max number of results in a search page.
+const searchLimit = 50
+
+// searchHit is a search result with snippet highlighted for templates.
+type searchHit struct {
+	services.SearchResult
+	Highlighted template.HTML
+}
+
+func (s *ginServer) search(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	var hits []searchHit
+	if query != "" {
+		for _, res := range s.notes.Search(query, searchLimit, viewerRole(c)) {
+			hits = append(hits, searchHit{
+				SearchResult: res,
+				Highlighted:  highlight(res.Snippet, res.Matches),
+			})
+		}
+	}
+	s.renderPage(c, http.StatusOK, "search", "搜索: "+query, gin.H{
+		"Query": query,
+		"Hits":  hits,
+	})
+}
+
+// highlight escape snippet and wrap matches with <mark>.
+func highlight(snippet string, matches [][2]int) template.HTML {
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(template.HTMLEscapeString(snippet[last:m[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(snippet[m[0]:m[1]]))
+		b.WriteString("</mark>")
+		last = m[1]
+	}
+	b.WriteString(template.HTMLEscapeString(snippet[last:]))
+	return template.HTML(b.String())
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"github.com/gin-gonic/gin"
 	logging "github.com/ipfs/go-log"
+	"go-blog/common"
 	"go-blog/config"
+	"go-blog/services"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"syscall"
@@ -46,24 +49,47 @@ type ginServer struct {
 	router	*gin.Engine
 	server  *http.Server	// Used to control the lifecycle of server.
 	cfg 	config.RunningConfig
+	dev		bool			// Dev mode set when the server is created, which is kept through restart.
 	prefix  string			// Used to build url. It depends on running config when initializing.
 	isRunning bool
 	cmdCh	chan serverCmd
 	errCh	chan error
 	wg		sync.WaitGroup
 	ctx 	context.Context
+	notes	services.NoteService
+	noteStore services.NoteStore // nil if note tree is persisted in index file.
+	templates *templateSet
+	users	services.UserStore // nil if it can not be opened.
+	sessionKey []byte		   // nil if it can not be loaded.
+	adminToken string		   // Empty if it can not be loaded, then commands are refused.
+	control	*http.Server	   // Serve control socket. nil if disabled.
 }
 
 // NewGinServer
 // TODO: Use config to control the behavior of engine.
 func NewGinServer(cfg config.Config) Server {
 	runCfg := cfg.RunningConfig()
+	setupMarkdown(cfg)
 	res := &ginServer{
 		cfg:    runCfg,
+		dev:    cfg.DevMode(),
 		isRunning: false,
 		cmdCh: make(chan serverCmd),
 		errCh: make(chan error),
 		ctx: context.Background(),
+		users: newUserStore(),
+		adminToken: loadAdminToken(),
+	}
+	if runCfg.HostOnly() {
+		res.prefix = "http://" + runCfg.Host()
+	} else {
+		res.prefix = "http://" + runCfg.Host() + ":" + strconv.Itoa(int(runCfg.Port()))
+	}
+	res.openNotes(cfg)
+	var err error
+	res.sessionKey, err = loadSessionKey(common.PathSessionKey())
+	if err != nil {
+		log.Error("Error when load session key, nobody can login: ", err)
 	}
 	res.initRouter()
 	res.server = &http.Server{
@@ -71,27 +97,102 @@ func NewGinServer(cfg config.Config) Server {
 		Handler: res.router,
 	}
 
-	if runCfg.HostOnly() {
-		res.prefix = "http://" + runCfg.Host()
+	return res
+}
+
+// openNotes create the note service from cfg and load notes from disk.
+// Note tree is persisted in the store chosen by cfg, or the index file if it can not be opened.
+// Failures of single notes are logged and would not stop the server.
+func (s *ginServer) openNotes(cfg config.Config) {
+	s.noteStore = nil
+	if cfg.NoteStore() == common.NOTE_STORE_BOLT {
+		store, err := services.OpenBoltNoteStore(common.PathNoteStore())
+		if err != nil {
+			log.Error("Error when open note store, note index file is used instead: ", err)
+		} else {
+			s.noteStore = store
+		}
+	} else if cfg.NoteStore() != "" {
+		log.Warn("Unknown note store ", cfg.NoteStore(), ", note index file is used instead.")
+	}
+	if s.noteStore != nil {
+		s.notes = services.NewFsNoteServiceWithStore(cfg.CacheDir(), cfg.NoteDir(), s.noteStore)
 	} else {
-		res.prefix = "http://" + runCfg.Host() + ":" + strconv.Itoa(int(runCfg.Port()))
+		s.notes = services.NewFsNoteService(cfg.CacheDir(), cfg.NoteDir())
+	}
+	s.notes.SetNoteURL(s.noteUrl)
+	_ = s.notes.LoadFromDisk()
+	err := s.notes.Watch()
+	if err != nil {
+		log.Error("Error when watch notes: ", err)
 	}
+}
 
-	return res
+// closeNotes stop watching notes, write the note tree back and close its store.
+func (s *ginServer) closeNotes() {
+	s.notes.StopWatch()
+	err := s.notes.WriteBack()
+	if err != nil {
+		log.Error("Error when write notes back: ", err)
+	}
+	if s.noteStore != nil {
+		err = s.noteStore.Close()
+		if err != nil {
+			log.Error("Error when close note store: ", err)
+		}
+		s.noteStore = nil
+	}
+}
+
+// setupMarkdown build the markdown renderer from cfg,
+// and write the stylesheet of highlighted code blocks into resource directory.
+func setupMarkdown(cfg config.Config) {
+	renderer := common.NewMdRenderer(cfg.Markdown())
+	common.SetMdRenderer(renderer)
+	err := renderer.WriteHighlightCSS(filepath.Join(cfg.Resource(), "css", "highlight.css"))
+	if err != nil {
+		log.Error("Error when write stylesheet of code blocks: ", err)
+	}
+}
+
+// reopenConfig read config file again for restart.
+// Dev mode may be set by command line instead of config file, so it is kept.
+func (s *ginServer) reopenConfig() (config.Config, error) {
+	cfg, err := config.OpenFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	if s.dev {
+		cfg.SetDevMode(true)
+	}
+	return cfg, nil
+}
+
+// closeTemplates stop reloading templates in dev mode.
+func (s *ginServer) closeTemplates() {
+	if s.templates != nil {
+		s.templates.close()
+		s.templates = nil
+	}
 }
 
 func (s *ginServer) reset(cfg config.Config) {
+	s.closeTemplates()
+	s.closeNotes()
+	setupMarkdown(cfg)
 	s.cfg = cfg.RunningConfig()
-	s.initRouter()
-	s.server = &http.Server{
-		Addr: ":" + strconv.Itoa(int(s.cfg.Port())),
-		Handler: s.router,
-	}
+	// Prefix is set before notes are opened, since links between notes are rendered with it.
 	if s.cfg.HostOnly() {
 		s.prefix = "http://" + s.cfg.Host()
 	} else {
 		s.prefix = "http://" + s.cfg.Host() + ":" + strconv.Itoa(int(s.cfg.Port()))
 	}
+	s.openNotes(cfg)
+	s.initRouter()
+	s.server = &http.Server{
+		Addr: ":" + strconv.Itoa(int(s.cfg.Port())),
+		Handler: s.router,
+	}
 }
 
 func (s *ginServer) Run() error {
@@ -119,13 +220,12 @@ func (s *ginServer) Run() error {
 				if s.isRunning {
 					log.Warn("Start when server is already started.")
 				} else {
-					s.isRunning = true
-					go s.startServer()
+					s.start()
 				}
 			case cmdServerRestart:
 				log.Debug("Server restart.")
 				if s.isRunning {
-					err = s.server.Shutdown(s.ctx)
+					err = s.shutdown()
 					if err != nil {
 						return err
 					}
@@ -134,17 +234,16 @@ func (s *ginServer) Run() error {
 				// Reopen config
 				log.Debug("Reconfigure server.")
 				var newCfg config.Config
-				newCfg, err = config.OpenFileConfig()
+				newCfg, err = s.reopenConfig()
 				if err != nil {
 					return err
 				}
 				s.reset(newCfg)
-				s.isRunning = true
-				go s.startServer()
+				s.start()
 			case cmdServerShutdown:
 				if s.isRunning {
 					log.Debug("Server Restart ...")
-					err = s.server.Shutdown(s.ctx)
+					err = s.shutdown()
 					if err != nil {
 						return err
 					}
@@ -157,30 +256,39 @@ func (s *ginServer) Run() error {
 			}
 
 		case err = <- s.errCh:
+			// The http server stopped by itself, but control socket is still served.
+			s.isRunning = false
+			s.stopControl()
 			return err
 		case <- quitCh:
-			err = s.server.Shutdown(s.ctx)
-			if err != nil {
-				return err
-			}
+			err = s.shutdown()
+			s.closeTemplates()
+			s.closeNotes()
+			return err
 		}
 	}
 }
 
+// start serve control socket and http in background.
+// It should only be called by Run, which is the only one changing the state of server.
+func (s *ginServer) start() {
+	s.isRunning = true
+	s.startControl()
+	s.wg.Add(1)
+	go s.startServer()
+}
+
+// startServer serve http until the server is shutdown, and send other errors to Run.
 func (s *ginServer) startServer() {
 	var err error
 	defer func() {
 		log.Debug("Server end with error: ", err)
 		s.wg.Done()
 	}()
-	s.wg.Add(1)
 	//err = s.router.Run(":" + strconv.Itoa(int(s.cfg.Port())))
 	err = s.server.ListenAndServe()
-	if err != nil {
-		s.isRunning = false
-		if err != http.ErrServerClosed {	// ServerClosed would not end the program
-			s.errCh <- err
-		}
+	if err != nil && err != http.ErrServerClosed {	// ServerClosed would not end the program
+		s.errCh <- err
 	}
 }
 
@@ -198,4 +306,9 @@ func (s *ginServer) Restart() {
 
 func (s *ginServer) buildUrl(relativePath string) string {
 	return s.prefix + relativePath
+}
+
+// noteUrl return the url of note with relative path, which links between notes are rendered to.
+func (s *ginServer) noteUrl(relative string) string {
+	return s.buildUrl(services.DefaultNoteURL(relative))
 }
\ No newline at end of file
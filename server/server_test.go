@@ -0,0 +1,109 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/config"
+	"go-blog/services"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMain keep the indexes written by servers in tests out of the real config directory.
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = ioutil.Discard
+	dir, err := ioutil.TempDir("", "goblog-server-test")
+	if err != nil {
+		panic(err)
+	}
+	_ = os.Setenv(common.ENV_CFG_DIR, dir)
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// writeFiles write files with relative paths and contents into dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestServer create a server over notes with relative paths and contents,
+// using resources in the repository.
+func newTestServer(t *testing.T, files map[string]string) *ginServer {
+	return newTestServerWith(t, files, nil)
+}
+
+// newTestServerWith is like newTestServer, but setup can change the config before server is created.
+func newTestServerWith(t *testing.T, files map[string]string, setup func(cfg config.Config)) *ginServer {
+	root := t.TempDir()
+	writeFiles(t, root, files)
+	cfg := config.NewFileConfig()
+	cfg.SetHost("127.0.0.1")
+	cfg.SetPort(8080)
+	cfg.SetResource(filepath.Join("..", "resources"))
+	cfg.SetNoteDir(root)
+	cfg.SetCacheDir(t.TempDir())
+	// The stylesheet of code blocks is not written into resources of the repository.
+	options := common.DefaultMdOptions
+	options.Highlight = false
+	cfg.SetMarkdown(options)
+	if setup != nil {
+		setup(cfg)
+	}
+	s := NewGinServer(cfg).(*ginServer)
+	t.Cleanup(s.closeNotes)
+	// Users are kept apart from other tests.
+	users, err := services.OpenFileUserStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.users = users
+	return s
+}
+
+// serve handle req with the router of s.
+func serve(s *ginServer, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func get(s *ginServer, target string) *httptest.ResponseRecorder {
+	return serve(s, httptest.NewRequest(http.MethodGet, target, nil))
+}
+
+func TestReopenConfig(t *testing.T) {
+	saved := config.NewFileConfig()
+	saved.SetNoteDir(t.TempDir())
+	if err := saved.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Remove(common.PathCfgFile()) })
+
+	for _, dev := range []bool{false, true} {
+		s := newTestServerWith(t, nil, func(cfg config.Config) {
+			cfg.SetDevMode(dev)
+		})
+		cfg, err := s.reopenConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.DevMode() != dev || cfg.NoteDir() != saved.NoteDir() {
+			t.Errorf("reopenConfig() of server with dev mode %v = dev mode %v, notes %q, want %v, %q",
+				dev, cfg.DevMode(), cfg.NoteDir(), dev, saved.NoteDir())
+		}
+	}
+}
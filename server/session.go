@@ -0,0 +1,195 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/services"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sessionCookie is the name of cookie keeping the session.
+const sessionCookie = "go_blog_session"
+
+// sessionAge is how long a login lasts.
+const sessionAge = 7 * 24 * time.Hour
+
+// userKey is the key of current user in gin context.
+const userKey = "user"
+
+// sessionKeySize is the number of random bytes of session key.
+const sessionKeySize = 32
+
+var errBadSession = errors.New("bad session")
+
+// loadSessionKey read the key signing sessions from file,
+// or generate one and write it to file if it does not exist.
+// Sessions keep valid across restarts as long as the key file is kept.
+func loadSessionKey(filePath string) ([]byte, error) {
+	key, err := ioutil.ReadFile(filePath)
+	if err == nil && len(key) >= sessionKeySize {
+		return key, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, sessionKeySize)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(filePath, key, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// signSession build the cookie value of a session of user expiring at expires.
+// The value is "payload.signature", in which payload is name, expire time and
+// a stamp of password hash, so that changing password ends existing sessions.
+func (s *ginServer) signSession(user *services.User, expires time.Time) string {
+	payload := strings.Join([]string{
+		user.Name,
+		strconv.FormatInt(expires.Unix(), 10),
+		passwordStamp(user),
+	}, "\n")
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sessionMac(encoded))
+}
+
+// verifySession check the cookie value and return the user it belongs to.
+func (s *ginServer) verifySession(value string) (*services.User, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 {
+		return nil, errBadSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, s.sessionMac(parts[0])) {
+		return nil, errBadSession
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errBadSession
+	}
+	fields := strings.Split(string(payload), "\n")
+	if len(fields) != 3 {
+		return nil, errBadSession
+	}
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, errBadSession
+	}
+	user, err := s.users.Get(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || passwordStamp(user) != fields[2] {
+		return nil, errBadSession
+	}
+	return user, nil
+}
+
+func (s *ginServer) sessionMac(payload string) []byte {
+	h := hmac.New(sha256.New, s.sessionKey)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func passwordStamp(user *services.User) string {
+	return common.HashBytes([]byte(user.Hash))[:16]
+}
+
+// setSession log user in by setting the session cookie.
+func (s *ginServer) setSession(c *gin.Context, user *services.User) {
+	expires := time.Now().Add(sessionAge)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    s.signSession(user, expires),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(sessionAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearSession log out by removing the session cookie.
+func (s *ginServer) clearSession(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loadUser middleware find the user of session and keep it in context.
+// Requests without a valid session go on as anonymous.
+func (s *ginServer) loadUser(c *gin.Context) {
+	if s.users == nil {
+		c.Next()
+		return
+	}
+	value, err := c.Cookie(sessionCookie)
+	if err == nil && value != "" {
+		user, err := s.verifySession(value)
+		if err == nil {
+			c.Set(userKey, user)
+		} else if err != errBadSession {
+			log.Error("Error when verify session: ", err)
+		}
+	}
+	c.Next()
+}
+
+// currentUser return the user logged in, or nil.
+func currentUser(c *gin.Context) *services.User {
+	if v, ok := c.Get(userKey); ok {
+		return v.(*services.User)
+	}
+	return nil
+}
+
+// viewerRole return the role of current user, or empty if not logged in.
+func viewerRole(c *gin.Context) string {
+	if user := currentUser(c); user != nil {
+		return user.Role
+	}
+	return ""
+}
+
+// requireRole return a middleware only allowing users with one of roles.
+// Anonymous users are redirected to login page and back after login.
+func (s *ginServer) requireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.Redirect(http.StatusFound, s.buildUrl("/login")+"?from="+url.QueryEscape(c.Request.URL.RequestURI()))
+			c.Abort()
+			return
+		}
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+		s.renderPage(c, http.StatusForbidden, "forbidden", "禁止访问", gin.H{
+			"Error": "user " + user.Name + " is not allowed to visit " + c.Request.URL.Path,
+		})
+		c.Abort()
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/base64"
+	"go-blog/services"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sessionRequest create a request to target with session cookie value.
+func sessionRequest(target string, value string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	return req
+}
+
+func TestVerifySession(t *testing.T) {
+	s := newTestServer(t, nil)
+	alice := addUser(t, s, "alice", "secret", services.RoleReader)
+	addUser(t, s, "admin", "secret", services.RoleAdmin)
+	valid := s.signSession(alice, time.Now().Add(time.Hour))
+	payload := strings.Split(valid, ".")[0]
+	signature := strings.Split(valid, ".")[1]
+	// forged sign payload of admin with the signature of alice.
+	forged := base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(
+		mustDecode(t, payload), "alice", "admin", 1))) + "." + signature
+
+	other := newTestServer(t, nil)
+	other.users = s.users
+	other.sessionKey = []byte(strings.Repeat("k", sessionKeySize))
+
+	tests := []struct {
+		name  string
+		s     *ginServer
+		value string
+		want  string // Name of user, empty if session is bad.
+	}{
+		{"valid", s, valid, "alice"},
+		{"tampered payload", s, forged, ""},
+		{"tampered signature", s, payload + "." + signature[1:], ""},
+		{"no signature", s, payload, ""},
+		{"expired", s, s.signSession(alice, time.Now().Add(-time.Second)), ""},
+		{"another key", other, valid, ""},
+		{"garbage", s, "a.b.c", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.s.verifySession(tt.value)
+			if tt.want == "" {
+				if err != errBadSession {
+					t.Errorf("verifySession() = %v, %v, want errBadSession", user, err)
+				}
+				return
+			}
+			if err != nil || user.Name != tt.want {
+				t.Errorf("verifySession() = %v, %v, want %s", user, err, tt.want)
+			}
+		})
+	}
+
+	// Changing password ends existing sessions.
+	if err := alice.SetPassword("changed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.users.Put(alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.verifySession(valid); err != errBadSession {
+		t.Errorf("verifySession() after password changed error = %v, want errBadSession", err)
+	}
+}
+
+func mustDecode(t *testing.T, s string) string {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRequireRole(t *testing.T) {
+	s := newTestServer(t, nil)
+	reader := addUser(t, s, "reader", "secret", services.RoleReader)
+	admin := addUser(t, s, "admin", "secret", services.RoleAdmin)
+	expired := s.signSession(admin, time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name  string
+		value string
+		code  int
+	}{
+		{"anonymous", "", http.StatusFound},
+		{"expired", expired, http.StatusFound},
+		{"reader", s.signSession(reader, time.Now().Add(time.Hour)), http.StatusForbidden},
+		{"admin", s.signSession(admin, time.Now().Add(time.Hour)), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(s, sessionRequest("/admin", tt.value))
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d", w.Code, tt.code)
+			}
+			if tt.code == http.StatusFound && !strings.HasSuffix(w.Header().Get("Location"), "/login?from=%2Fadmin") {
+				t.Errorf("redirected to %q, want login page back to /admin", w.Header().Get("Location"))
+			}
+		})
+	}
+}
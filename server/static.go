@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"go-blog/common"
+	"go-blog/resources"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache-Control of static resources.
+// Fingerprinted assets never change under the same name, so they can be cached forever.
+// Others should be revalidated with ETag or Last-Modified before use.
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "public, no-cache"
+)
+
+// fingerprintPattern match names with a hash before extension, such as base.3f9a1c2d.css.
+var fingerprintPattern = regexp.MustCompile(`\.[0-9a-fA-F]{8,}\.[^.]+$`)
+
+// encodings are the precompressed variants looked for, in order of preference.
+// A variant is a file beside the original with the suffix, such as base.css.br.
+var encodings = []struct {
+	name   string
+	suffix string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// etagEntry is a cached ETag, valid while the file keeps its modification time and size.
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etagCache avoid hashing static files on every request.
+var etagCache sync.Map // Absolute path -> *etagEntry
+
+// resource serve files in resource directory under /res.
+// Templates are not served since they are not meant to be public.
+func (s *ginServer) resource(c *gin.Context) {
+	relative := path.Clean("/" + c.Param("path"))
+	if relative == "/templates" || strings.HasPrefix(relative, "/templates/") {
+		s.notFound(c, &common.ErrNoSuchNode{Relative: relative})
+		return
+	}
+	s.serveResource(c, relative)
+}
+
+// favicon serve icon/favicon.ico of resource directory for browsers looking for /favicon.ico.
+func (s *ginServer) favicon(c *gin.Context) {
+	s.serveResource(c, "/icon/favicon.ico")
+}
+
+// resourceDirs return the directories resources are looked up in, in order.
+// Theme directory comes first so that a theme can override only some of the resources.
+func (s *ginServer) resourceDirs() []string {
+	if theme := s.cfg.ThemeDir(); theme != "" {
+		return []string{theme, s.cfg.Resource()}
+	}
+	return []string{s.cfg.Resource()}
+}
+
+// serveResource serve the file with relative path in resource directory or theme directory.
+// The resource embedded in binary is served if it is not found on disk.
+// A precompressed variant is served instead if it exists and is accepted by client.
+// Conditional and range requests are handled by http.ServeContent.
+func (s *ginServer) serveResource(c *gin.Context, relative string) {
+	if strings.Contains(relative, "/.") {
+		s.notFound(c, &common.ErrNoSuchNode{Relative: relative})
+		return
+	}
+	var filePath string
+	var info os.FileInfo
+	for _, dir := range s.resourceDirs() {
+		p := filepath.Join(dir, filepath.FromSlash(relative))
+		if i, err := os.Stat(p); err == nil && !i.IsDir() {
+			filePath, info = p, i
+			break
+		}
+	}
+	if info == nil {
+		if !serveEmbedded(c, relative) {
+			s.notFound(c, &common.ErrNoSuchNode{Relative: relative})
+		}
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Add("Vary", "Accept-Encoding")
+	servePath := filePath
+	for _, enc := range encodings {
+		if !acceptEncoding(c.GetHeader("Accept-Encoding"), enc.name) {
+			continue
+		}
+		if vInfo, err := os.Stat(filePath + enc.suffix); err == nil && !vInfo.IsDir() {
+			servePath = filePath + enc.suffix
+			info = vInfo
+			header.Set("Content-Encoding", enc.name)
+			break
+		}
+	}
+
+	f, err := os.Open(servePath)
+	if err != nil {
+		log.Error("Error when open resource ", servePath, ": ", err)
+		c.String(http.StatusInternalServerError, "Error when read resource.")
+		return
+	}
+	defer f.Close()
+
+	etag, err := fileETag(servePath, info)
+	if err != nil {
+		log.Error("Error when hash resource ", servePath, ": ", err)
+	} else {
+		header.Set("ETag", etag)
+	}
+	header.Set("Cache-Control", cacheControl(filePath))
+	// Content type is detected from the name of the original file rather than the variant.
+	http.ServeContent(c.Writer, c.Request, filepath.Base(filePath), info.ModTime(), f)
+}
+
+// serveEmbedded serve the resource embedded in binary, and report whether it exists.
+func serveEmbedded(c *gin.Context, relative string) bool {
+	data, err := fs.ReadFile(resources.FS, strings.TrimPrefix(relative, "/"))
+	if err != nil {
+		return false
+	}
+	header := c.Writer.Header()
+	header.Set("ETag", strconv.Quote(common.HashBytes(data)[:32]))
+	header.Set("Cache-Control", cacheControl(relative))
+	// Embedded files have no modification time, so they are validated by ETag only.
+	http.ServeContent(c.Writer, c.Request, path.Base(relative), time.Time{}, bytes.NewReader(data))
+	return true
+}
+
+// cacheControl return the Cache-Control header of resource with name.
+func cacheControl(name string) string {
+	if fingerprintPattern.MatchString(name) {
+		return cacheImmutable
+	}
+	return cacheRevalidate
+}
+
+// fileETag return the strong ETag of file, which is derived from its content.
+func fileETag(filePath string, info os.FileInfo) (string, error) {
+	if v, ok := etagCache.Load(filePath); ok {
+		entry := v.(*etagEntry)
+		if entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+			return entry.etag, nil
+		}
+	}
+	hash, err := common.HashFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	etag := strconv.Quote(hash[:32])
+	etagCache.Store(filePath, &etagEntry{modTime: info.ModTime(), size: info.Size(), etag: etag})
+	return etag, nil
+}
+
+// acceptEncoding report whether the Accept-Encoding header allows encoding,
+// either by name or by "*", and not with q=0.
+func acceptEncoding(header string, encoding string) bool {
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name != encoding && name != "*" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
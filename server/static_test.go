@@ -0,0 +1,178 @@
+package server
+
+import (
+	"go-blog/common"
+	"go-blog/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestResourceServer create a server with resource directory of files,
+// which shares templates in the repository.
+func newTestResourceServer(t *testing.T, files map[string]string) *ginServer {
+	res := t.TempDir()
+	writeFiles(t, res, files)
+	templates, err := filepath.Abs(filepath.Join("..", "resources", "templates"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(templates, filepath.Join(res, "templates")); err != nil {
+		t.Fatal(err)
+	}
+	return newTestServerWith(t, nil, func(cfg config.Config) {
+		cfg.SetResource(res)
+		cfg.SetMarkdown(common.DefaultMdOptions)
+	})
+}
+
+func TestServeResource(t *testing.T) {
+	s := newTestResourceServer(t, map[string]string{
+		"css/base.css":         "body {}",
+		"css/base.css.br":      "brotli",
+		"css/base.css.gz":      "gzip",
+		"css/app.0123abcd.css": "p {}",
+		"css/.hidden.css":      "hidden",
+		"icon/favicon.ico":     "icon",
+	})
+	tests := []struct {
+		name     string
+		target   string
+		accept   string // Accept-Encoding
+		code     int
+		body     string
+		encoding string
+		cache    string
+	}{
+		{"plain", "/res/css/base.css", "", http.StatusOK, "body {}", "", cacheRevalidate},
+		{"brotli preferred", "/res/css/base.css", "gzip, br", http.StatusOK, "brotli", "br", cacheRevalidate},
+		{"gzip", "/res/css/base.css", "gzip", http.StatusOK, "gzip", "gzip", cacheRevalidate},
+		{"brotli refused", "/res/css/base.css", "br;q=0, gzip", http.StatusOK, "gzip", "gzip", cacheRevalidate},
+		{"any", "/res/css/base.css", "*", http.StatusOK, "brotli", "br", cacheRevalidate},
+		{"no variant", "/res/css/app.0123abcd.css", "br, gzip", http.StatusOK, "p {}", "", cacheImmutable},
+		{"favicon", "/favicon.ico", "", http.StatusOK, "icon", "", cacheRevalidate},
+		{"hidden", "/res/css/.hidden.css", "", http.StatusNotFound, "", "", ""},
+		{"templates", "/res/templates/layout.html", "", http.StatusNotFound, "", "", ""},
+		{"directory", "/res/css", "", http.StatusNotFound, "", "", ""},
+		{"missing", "/res/css/missing.css", "", http.StatusNotFound, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := serve(s, req)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d", w.Code, tt.code)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			h := w.Header()
+			if w.Body.String() != tt.body || h.Get("Content-Encoding") != tt.encoding {
+				t.Errorf("body = %q with encoding %q, want %q with %q",
+					w.Body.String(), h.Get("Content-Encoding"), tt.body, tt.encoding)
+			}
+			if h.Get("Cache-Control") != tt.cache {
+				t.Errorf("Cache-Control = %q, want %q", h.Get("Cache-Control"), tt.cache)
+			}
+			if h.Get("ETag") == "" || h.Get("Vary") != "Accept-Encoding" {
+				t.Errorf("ETag = %q, Vary = %q, want an ETag varying by Accept-Encoding", h.Get("ETag"), h.Get("Vary"))
+			}
+		})
+	}
+	if ct := get(s, "/res/css/base.css").Header().Get("Content-Type"); ct != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want the one of css", ct)
+	}
+}
+
+func TestServeResourceConditional(t *testing.T) {
+	s := newTestResourceServer(t, map[string]string{
+		"css/base.css":    "body {}",
+		"css/base.css.gz": "gzip",
+	})
+	etag := get(s, "/res/css/base.css").Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/res/css/base.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	if w := serve(s, req); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("status = %d with %d bytes, want 304 without body", w.Code, w.Body.Len())
+	}
+
+	// Variants have their own ETag.
+	req = httptest.NewRequest(http.MethodGet, "/res/css/base.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	w := serve(s, req)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("status = %d with ETag %s, want gzip variant with another ETag", w.Code, w.Header().Get("ETag"))
+	}
+
+	// ETag follows changes of content.
+	writeFiles(t, s.cfg.Resource(), map[string]string{"css/base.css": "body { margin: 0 }"})
+	if got := get(s, "/res/css/base.css").Header().Get("ETag"); got == etag {
+		t.Error("ETag is not changed with content")
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		header   string
+		encoding string
+		want     bool
+	}{
+		{"", "gzip", false},
+		{"gzip", "gzip", true},
+		{"deflate, GZIP", "gzip", true},
+		{"gzip;q=0.5", "gzip", true},
+		{"gzip;q=0", "gzip", false},
+		{"*", "br", true},
+		{"br;q=0, *", "br", false},
+		{"gzip", "br", false},
+	}
+	for _, tt := range tests {
+		if got := acceptEncoding(tt.header, tt.encoding); got != tt.want {
+			t.Errorf("acceptEncoding(%q, %q) = %v, want %v", tt.header, tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedResources(t *testing.T) {
+	// Resource directory without anything falls back to resources embedded in binary.
+	s := newTestServerWith(t, map[string]string{"a.md": "# A\n"}, func(cfg config.Config) {
+		cfg.SetResource(t.TempDir())
+	})
+	if w := get(s, "/notes/a.md"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Go Blog") {
+		t.Errorf("status = %d, want page rendered with embedded templates:\n%s", w.Code, w.Body.String())
+	}
+
+	w := get(s, "/res/css/base.css")
+	if w.Code != http.StatusOK || w.Body.Len() == 0 || w.Header().Get("Cache-Control") != cacheRevalidate {
+		t.Fatalf("status = %d with %d bytes, Cache-Control %q, want embedded css to be revalidated",
+			w.Code, w.Body.Len(), w.Header().Get("Cache-Control"))
+	}
+	etag := w.Header().Get("ETag")
+	req := httptest.NewRequest(http.MethodGet, "/res/css/base.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	if w := serve(s, req); etag == "" || w.Code != http.StatusNotModified {
+		t.Errorf("status = %d with ETag %q, want 304", w.Code, etag)
+	}
+	if w := get(s, "/res/templates/layout.html"); w.Code != http.StatusNotFound {
+		t.Errorf("status of embedded template = %d, want 404", w.Code)
+	}
+}
+
+func TestServeHighlightCSS(t *testing.T) {
+	s := newTestResourceServer(t, nil)
+	w := get(s, "/res/css/highlight.css")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), ".chroma") {
+		t.Errorf("GET /res/css/highlight.css = %d %q, want the generated stylesheet", w.Code, w.Body.String())
+	}
+	if w := get(s, "/home"); !strings.Contains(w.Body.String(), "/res/css/highlight.css") {
+		t.Error("layout does not link the stylesheet of code blocks")
+	}
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-blog/services"
+	"net/http"
+)
+
+func (s *ginServer) tags(c *gin.Context) {
+	s.renderPage(c, http.StatusOK, "tags", "标签", gin.H{
+		"Tags":       s.notes.Tags(viewerRole(c)),
+		"Categories": s.notes.Categories(viewerRole(c)),
+	})
+}
+
+func (s *ginServer) tag(c *gin.Context) {
+	name := c.Param("tag")
+	s.renderNoteList(c, "标签: "+name, s.notes.NotesOfTag(name, viewerRole(c)))
+}
+
+func (s *ginServer) category(c *gin.Context) {
+	name := c.Param("category")
+	s.renderNoteList(c, "分类: "+name, s.notes.NotesOfCategory(name, viewerRole(c)))
+}
+
+// renderNoteList render notes of a tag or category. It would be 404 if there is no note.
+func (s *ginServer) renderNoteList(c *gin.Context, title string, notes []services.NoteRef) {
+	code := http.StatusOK
+	if len(notes) == 0 {
+		code = http.StatusNotFound
+	}
+	s.renderPage(c, code, "note_list", title, gin.H{
+		"Name":  title,
+		"Notes": notes,
+	})
+}
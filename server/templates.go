@@ -0,0 +1,139 @@
+package server
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"go-blog/common"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// templateReloadDelay is the time of quiet waited before reloading templates,
+// since saving a file may cause several events.
+const templateReloadDelay = 200 * time.Millisecond
+
+var templateFuncs = template.FuncMap{
+	"pathEscape": url.PathEscape,
+}
+
+// templateSet hold the templates parsed from templates directories of resource and theme,
+// on top of the templates embedded in binary.
+// Templates in later directories override those with the same name in former ones,
+// so that a theme only needs to define templates it changes,
+// and a template missing on disk falls back to the embedded one.
+// In dev mode, templates would be reloaded when files in directories change.
+// templateSet is thread safe.
+type templateSet struct {
+	base    fs.FS // Contains templates/*.html.
+	dirs    []string
+	tmpl    *template.Template
+	lock    sync.RWMutex
+	watcher *fsnotify.Watcher // nil if not in dev mode.
+	closeCh chan struct{}
+}
+
+// newTemplateSet parse templates in base and dirs. It would watch dirs for changes if dev is true.
+func newTemplateSet(base fs.FS, dirs []string, dev bool) (*templateSet, error) {
+	t := &templateSet{
+		base:    base,
+		dirs:    dirs,
+		closeCh: make(chan struct{}),
+	}
+	err := t.reload()
+	if err != nil {
+		return nil, err
+	}
+	if dev {
+		t.watcher, err = fsnotify.NewWatcher()
+		for i := 0; err == nil && i < len(dirs); i++ {
+			// A theme may have no templates directory.
+			if common.DirectoryExist(dirs[i]) {
+				err = t.watcher.Add(dirs[i])
+			}
+		}
+		if err != nil {
+			log.Error("Error when watch templates, they would not be reloaded: ", err)
+			if t.watcher != nil {
+				t.watcher.Close()
+				t.watcher = nil
+			}
+		} else {
+			go t.watch()
+		}
+	}
+	return t, nil
+}
+
+// reload parse all templates again. The old ones are kept if any template is broken.
+func (t *templateSet) reload() error {
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(t.base, "templates/*.html")
+	if err != nil {
+		return err
+	}
+	for _, dir := range t.dirs {
+		files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			continue
+		}
+		// Templates defined again replace the former ones since none has been executed.
+		tmpl, err = tmpl.ParseFiles(files...)
+		if err != nil {
+			return err
+		}
+	}
+	t.lock.Lock()
+	t.tmpl = tmpl
+	t.lock.Unlock()
+	return nil
+}
+
+func (t *templateSet) watch() {
+	timer := time.NewTimer(templateReloadDelay)
+	timer.Stop()
+	for {
+		select {
+		case _, ok := <-t.watcher.Events:
+			if !ok {
+				return
+			}
+			timer.Reset(templateReloadDelay)
+		case err, ok := <-t.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error("Error when watch templates: ", err)
+		case <-timer.C:
+			err := t.reload()
+			if err != nil {
+				log.Error("Error when reload templates, keep the old ones: ", err)
+			} else {
+				log.Debug("Templates reloaded.")
+			}
+		case <-t.closeCh:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (t *templateSet) execute(w io.Writer, name string, data interface{}) error {
+	t.lock.RLock()
+	tmpl := t.tmpl
+	t.lock.RUnlock()
+	return tmpl.ExecuteTemplate(w, name, data)
+}
+
+// close stop watching templates.
+func (t *templateSet) close() {
+	if t.watcher != nil {
+		close(t.closeCh)
+		t.watcher.Close()
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"go-blog/common"
+	"go-blog/config"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func writeTemplate(t *testing.T, dir string, content string) {
+	if err := ioutil.WriteFile(filepath.Join(dir, "t.html"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func executeTemplate(t *testing.T, set *templateSet) string {
+	var buf bytes.Buffer
+	if err := set.execute(&buf, "t", nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+// noTemplates is a base of templateSet without any template of use.
+var noTemplates = fstest.MapFS{"templates/empty.html": &fstest.MapFile{}}
+
+func TestTemplateSetReload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, `{{define "t"}}v1{{end}}`)
+	set, err := newTemplateSet(noTemplates, []string{dir}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.close()
+	if got := executeTemplate(t, set); got != "v1" {
+		t.Fatalf("execute() = %q, want v1", got)
+	}
+
+	writeTemplate(t, dir, `{{define "t"}}v2{{end}}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for executeTemplate(t, set) != "v2" {
+		if time.Now().After(deadline) {
+			t.Fatal("changed template is not reloaded in dev mode")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Broken templates are not loaded, the old ones are kept.
+	writeTemplate(t, dir, `{{define "t"}}{{.Broken{{end}}`)
+	time.Sleep(3 * templateReloadDelay)
+	if got := executeTemplate(t, set); got != "v2" {
+		t.Errorf("execute() after broken change = %q, want v2", got)
+	}
+}
+
+func TestTemplateSetWithoutDevMode(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, `{{define "t"}}v1{{end}}`)
+	set, err := newTemplateSet(noTemplates, []string{dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.close()
+	writeTemplate(t, dir, `{{define "t"}}v2{{end}}`)
+	time.Sleep(3 * templateReloadDelay)
+	if got := executeTemplate(t, set); got != "v1" {
+		t.Errorf("execute() = %q, want templates not reloaded out of dev mode", got)
+	}
+
+	if _, err := newTemplateSet(fstest.MapFS{}, []string{dir}, false); err == nil {
+		t.Error("newTemplateSet() without embedded templates succeeded, want error")
+	}
+}
+
+func TestPageModel(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\n"})
+	body := get(s, "/notes/a.md").Body.String()
+	for _, want := range []string{"Go Blog", "http://127.0.0.1:8080/home", "http://127.0.0.1:8080/tags"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %q", want)
+		}
+	}
+}
+
+func TestTemplateSetOverride(t *testing.T) {
+	embedded := fstest.MapFS{
+		"templates/t.html":      &fstest.MapFile{Data: []byte(`{{define "t"}}embedded{{end}}`)},
+		"templates/other.html":  &fstest.MapFile{Data: []byte(`{{define "other"}}embedded other{{end}}`)},
+		"templates/unused.html": &fstest.MapFile{Data: []byte(`{{define "part"}}embedded part{{end}}`)},
+	}
+	base, theme, empty := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFiles(t, base, map[string]string{
+		"t.html": `{{define "t"}}base {{template "part"}}{{end}}{{define "part"}}base part{{end}}`,
+	})
+	writeFiles(t, theme, map[string]string{
+		"t.html": `{{define "t"}}theme {{template "part"}}{{end}}`,
+	})
+	// Later directories override former ones and embedded templates,
+	// templates not defined again are kept.
+	set, err := newTemplateSet(embedded, []string{base, empty, theme}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer set.close()
+	if got := executeTemplate(t, set); got != "theme base part" {
+		t.Errorf("execute() = %q, want theme template using base part", got)
+	}
+	var buf bytes.Buffer
+	if err := set.execute(&buf, "other", nil); err != nil || buf.String() != "embedded other" {
+		t.Errorf("execute() of template only embedded = %q, %v, want embedded other", buf.String(), err)
+	}
+}
+
+func TestTheme(t *testing.T) {
+	name := "test-theme"
+	theme := filepath.Join(common.PathThemeDir(), name)
+	t.Cleanup(func() { _ = os.RemoveAll(theme) })
+	writeFiles(t, theme, map[string]string{
+		"templates/note.html": `{{define "note"}}themed {{.Title}}{{end}}`,
+		"css/base.css":        "themed css",
+	})
+	s := newTestServerWith(t, map[string]string{"a.md": "# A\n"}, func(cfg config.Config) {
+		cfg.SetTheme(name)
+	})
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/notes/a.md", "themed a"}, // Overridden template, embedded in layout of resource.
+		{"/notes/a.md", "Go Blog"},  // Layout of resource.
+		{"/notes", "a.md"},          // Template in the same file which is not overridden.
+		{"/res/css/base.css", "themed css"},
+	}
+	for _, tt := range tests {
+		if body := get(s, tt.target).Body.String(); !strings.Contains(body, tt.want) {
+			t.Errorf("%s does not contain %q:\n%s", tt.target, tt.want, body)
+		}
+	}
+	// Resources not in theme fall back to resource directory.
+	if w := get(s, "/favicon.ico"); w.Code != http.StatusOK {
+		t.Errorf("status of /favicon.ico = %d, want it from resource directory", w.Code)
+	}
+}
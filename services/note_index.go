@@ -0,0 +1,288 @@
+package services
+
+import (
+	"encoding/json"
+	"go-blog/common"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// WriteBack write the whole tree into the index file so that
+// it can be restored by LoadFromDisk without rendering everything again.
+// The tree would be written into store instead if note service has one.
+// Search index is saved as well.
+func (ns *fsNoteService) WriteBack() error {
+	err := ns.search.Save()
+	if err != nil {
+		log.Error("Error when save search index: ", err)
+		return err
+	}
+	if ns.store != nil {
+		err := ns.writeStore()
+		if err != nil {
+			log.Error("Error when write note tree to store: ", err)
+		}
+		return err
+	}
+
+	ns.lock.RLock()
+	var data []byte
+	data, err = json.Marshal(ns.root)
+	ns.lock.RUnlock()
+	if err != nil {
+		log.Error("Error when convert note tree to json: ", err)
+		return err
+	}
+
+	// Write to a temporary file first so that a crash would not leave a broken index.
+	tmpPath := ns.indexPath + ".tmp"
+	err = ioutil.WriteFile(tmpPath, data, 0664)
+	if err != nil {
+		log.Error("Error when write note index: ", err)
+		return err
+	}
+	err = os.Rename(tmpPath, ns.indexPath)
+	if err != nil {
+		log.Error("Error when replace note index: ", err)
+	}
+	return err
+}
+
+// readIndex restore the tree from the index file.
+// Nothing would be done if the index does not exist
+// or it was written for another notes root or cache directory.
+// The tree would be restored from store instead if note service has one.
+func (ns *fsNoteService) readIndex() error {
+	if ns.store != nil {
+		return ns.readStore()
+	}
+	if !common.FileExist(ns.indexPath) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(ns.indexPath)
+	if err != nil {
+		return err
+	}
+	root := &NoteTreeNode{}
+	err = json.Unmarshal(data, root)
+	if err != nil {
+		return err
+	}
+
+	root.relink(nil)
+	ns.replaceRoot(root)
+	return nil
+}
+
+// replaceRoot replace the tree of note service with a restored one
+// unless it was written for another notes root or cache directory.
+func (ns *fsNoteService) replaceRoot(root *NoteTreeNode) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	if filepath.Clean(root.RawPath) != filepath.Clean(ns.root.RawPath) ||
+		filepath.Clean(root.RenderedPath) != filepath.Clean(ns.root.RenderedPath) {
+		log.Warn("Note index is written for another directory, ignore it.")
+		return
+	}
+	ns.root = root
+}
+
+// storeEntry is a node changed since it was last put into or got from store.
+type storeEntry struct {
+	relative string
+	node     *NoteTreeNode // Node in tree.
+	copy     *NoteTreeNode // Light copy of node taken with lock of tree held.
+	sig      string
+}
+
+// writeStore synchronize the store with the tree in a single transaction.
+// Only nodes loaded in memory are visited, and only the ones changed since they were
+// last put or got are written. Children of loaded directories which are unlinked from tree
+// are deleted from store with their descendants.
+// The tree is only read locked while changes are collected, and is not locked while they are written.
+func (ns *fsNoteService) writeStore() error {
+	ns.storeLock.Lock()
+	defer ns.storeLock.Unlock()
+
+	var changed []storeEntry
+	linked := make(map[string]map[string]bool) // Names of children of loaded directories.
+	ns.lock.RLock()
+	err := ns.root.walkLoaded(func(node *NoteTreeNode) error {
+		relative := node.relativePath()
+		cp := node.LightCopy()
+		data, err := json.Marshal(cp)
+		if err != nil {
+			return err
+		}
+		if sig := storeSig(relative, data); sig != node.storeSig {
+			changed = append(changed, storeEntry{relative: relative, node: node, copy: cp, sig: sig})
+		}
+		if node.IsDir && node.childrenLoaded() {
+			names := make(map[string]bool, len(node.Links))
+			for name := range node.Links {
+				names[name] = true
+			}
+			linked[relative] = names
+		}
+		return nil
+	})
+	ns.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	err = ns.store.Update(func(w NoteStoreWriter) error {
+		for _, entry := range changed {
+			err := w.Put(entry.relative, entry.copy)
+			if err != nil {
+				return err
+			}
+		}
+		for relative, names := range linked {
+			stored, err := w.Children(relative)
+			if err != nil {
+				return err
+			}
+			for _, name := range stored {
+				if !names[name] {
+					err = w.Delete(path.Join(relative, name))
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Nodes changed again since collected keep their old signature, so they are written next time.
+	ns.lock.Lock()
+	for _, entry := range changed {
+		entry.node.storeSig = entry.sig
+	}
+	ns.lock.Unlock()
+	return nil
+}
+
+// readStore restore the root of tree from store.
+// Children of directories are loaded from store on their first access,
+// see loadChildren.
+func (ns *fsNoteService) readStore() error {
+	root, err := ns.store.Get("/")
+	if _, ok := err.(*common.ErrNoSuchNode); ok {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	root.stored(ns.store, "/")
+	ns.replaceRoot(root)
+	return nil
+}
+
+// storeSig return the signature of entry in store with relative path and json data.
+func storeSig(relative string, data []byte) string {
+	return common.HashBytes(append([]byte(relative+"\x00"), data...))
+}
+
+// lazyChildren load children of a directory node from store once.
+type lazyChildren struct {
+	once   sync.Once
+	store  NoteStore
+	loaded int32 // Set to 1 once children are loaded. Accessed atomically.
+}
+
+// stored mark n as got from store with relative path.
+func (n *NoteTreeNode) stored(store NoteStore, relative string) {
+	data, err := json.Marshal(n.LightCopy())
+	if err == nil {
+		n.storeSig = storeSig(relative, data)
+	}
+	if n.IsDir {
+		n.lazy = &lazyChildren{store: store}
+	}
+}
+
+// loadChildren link the children of n kept in store if they are not linked yet.
+// It is safe to be called with read lock of tree held.
+// Children failed to load are left out, they would be linked again by next scan.
+func (n *NoteTreeNode) loadChildren() {
+	if n.lazy == nil {
+		return
+	}
+	n.lazy.once.Do(func() {
+		relative := n.relativePath()
+		names, err := n.lazy.store.Children(relative)
+		if err != nil {
+			log.Error("Error when load children of ", relative, " from store: ", err)
+			return
+		}
+		for _, name := range names {
+			childPath := path.Join(relative, name)
+			child, err := n.lazy.store.Get(childPath)
+			if err != nil {
+				log.Error("Error when load ", childPath, " from store: ", err)
+				continue
+			}
+			child.parent = n
+			child.stored(n.lazy.store, childPath)
+			n.Links[name] = child
+		}
+		atomic.StoreInt32(&n.lazy.loaded, 1)
+	})
+}
+
+// childrenLoaded report whether children of n are linked,
+// which is false if they are kept in store and not loaded yet.
+func (n *NoteTreeNode) childrenLoaded() bool {
+	return n.lazy == nil || atomic.LoadInt32(&n.lazy.loaded) == 1
+}
+
+// walk call fn with n and all its descendants, parents before children.
+func (n *NoteTreeNode) walk(fn func(*NoteTreeNode) error) error {
+	err := fn(n)
+	if err != nil {
+		return err
+	}
+	n.loadChildren()
+	for _, child := range n.Links {
+		err = child.walk(fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkLoaded is the same as walk, but children kept in store and not loaded yet are not visited.
+func (n *NoteTreeNode) walkLoaded(fn func(*NoteTreeNode) error) error {
+	err := fn(n)
+	if err != nil || !n.childrenLoaded() {
+		return err
+	}
+	for _, child := range n.Links {
+		err = child.walkLoaded(fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relink restore the parent links of n and its children, which are not kept in index.
+func (n *NoteTreeNode) relink(parent *NoteTreeNode) {
+	n.parent = parent
+	if n.Links == nil {
+		n.Links = make(map[string]*NoteTreeNode)
+	}
+	for _, child := range n.Links {
+		child.relink(n)
+	}
+}
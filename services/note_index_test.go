@@ -0,0 +1,134 @@
+package services
+
+import (
+	"go-blog/common"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// reopen create another note service over the same directories and index as ns,
+// like the one created when the server starts again.
+func reopen(ns *fsNoteService) *fsNoteService {
+	res := NewFsNoteService(ns.root.RenderedPath, ns.root.RawPath).(*fsNoteService)
+	res.indexPath = ns.indexPath
+	search, err := OpenSearchIndex(ns.search.path)
+	if err != nil {
+		search = newSearchIndex(ns.search.path)
+	}
+	setSearchIndex(res, search)
+	return res
+}
+
+// markRendered replace the rendered files of notes with a marker,
+// which would be kept unless they are rendered again.
+func markRendered(t *testing.T, cache string, names ...string) {
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(cache, name), []byte("marker"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func isRenderedAgain(t *testing.T, cache string, name string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(cache, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data) != "marker"
+}
+
+func TestWriteBackAndReload(t *testing.T) {
+	ns, root, cache := newTestNotes(t, map[string]string{
+		"a.md":     "# A\n",
+		"dir/b.md": "# B\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	renderTime := ns.Fetch("/a.md", false).RenderTime
+
+	markRendered(t, cache, "a.html", "dir/b.html")
+	writeNotes(t, root, map[string]string{"dir/b.md": "# B changed\n"})
+	reloaded := reopen(ns)
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if isRenderedAgain(t, cache, "a.html") {
+		t.Error("a.md is rendered again though its source is not changed")
+	}
+	if !isRenderedAgain(t, cache, "dir/b.html") {
+		t.Error("dir/b.md is not rendered again after its source changed")
+	}
+	a := reloaded.Fetch("/a.md", false)
+	if a == nil || !a.RenderTime.Equal(renderTime) || a.Hash != ns.Fetch("/a.md", false).Hash {
+		t.Errorf("a.md restored as %+v, want render time and hash kept", a)
+	}
+	if b := reloaded.Fetch("/dir/b.md", false); b == nil || b.parent == nil || b.parent.Name != "dir" {
+		t.Error("parent links are not restored")
+	}
+}
+
+func TestReloadIgnoredIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		index func(ns *fsNoteService) string // Content of index file.
+	}{
+		{"broken index", func(ns *fsNoteService) string { return "{" }},
+		{"index of other root", func(ns *fsNoteService) string {
+			return `{"IsDir":true,"Name":".","RawPath":"/elsewhere","RenderedPath":"` + ns.root.RenderedPath + `"}`
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, _, cache := newTestNotes(t, map[string]string{"a.md": "# A\n"})
+			if err := ns.LoadFromDisk(); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(ns.indexPath, []byte(tt.index(ns)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			markRendered(t, cache, "a.html")
+			reloaded := reopen(ns)
+			if err := reloaded.LoadFromDisk(); err != nil {
+				t.Fatal(err)
+			}
+			if !isRenderedAgain(t, cache, "a.html") {
+				t.Error("notes are not rendered again without a usable index")
+			}
+			if reloaded.Fetch("/a.md", false) == nil {
+				t.Error("a.md is not loaded")
+			}
+		})
+	}
+}
+
+func TestReloadRendererChanged(t *testing.T) {
+	defer common.SetMdRenderer(common.CurrentMdRenderer())
+	ns, _, cache := newTestNotes(t, map[string]string{"a.md": "# A\n"})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+
+	markRendered(t, cache, "a.html")
+	options := common.DefaultMdOptions
+	options.HeadingID = false
+	common.SetMdRenderer(common.NewMdRenderer(options))
+	reloaded := reopen(ns)
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if !isRenderedAgain(t, cache, "a.html") {
+		t.Error("a.md is not rendered again after the markdown renderer changed")
+	}
+	want := renderSig(common.CurrentMdRenderer(), &common.MdLinks{URL: DefaultNoteURL})
+	if sig := reloaded.Fetch("/a.md", false).RenderSig; sig != want {
+		t.Errorf("RenderSig = %q, want signature of current renderer", sig)
+	}
+}
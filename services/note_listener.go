@@ -0,0 +1,109 @@
+package services
+
+import "strings"
+
+// NoteListener is notified after notes in the tree of note service changed,
+// so that indexes built on notes can be kept up to date.
+// Listeners are called with the lock of note service held,
+// so they should not call note service in turn.
+type NoteListener interface {
+	// NoteUpdated is called when a note is added or rendered again.
+	NoteUpdated(relative string, node *NoteTreeNode)
+	// NoteRemoved is called when a note is unlinked from the tree.
+	NoteRemoved(relative string)
+}
+
+// noteChanges collects the changes of notes during an operation on tree.
+// Directories are not recorded, but the notes inside them are.
+type noteChanges struct {
+	updated  []noteChange
+	removed  []string
+	pending  []pendingRender // Notes to be rendered, see fsNoteService.renderPending.
+	relinked []string        // Notes whose visibility changed, links to which should be resolved again.
+	linked   bool            // Whether new nodes are linked into tree.
+}
+
+type noteChange struct {
+	relative string
+	node     *NoteTreeNode
+}
+
+type pendingRender struct {
+	node      *NoteTreeNode
+	overWrite bool
+}
+
+// update record n as updated. It should be called while n is linked.
+func (c *noteChanges) update(n *NoteTreeNode) {
+	_ = n.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir {
+			c.updated = append(c.updated, noteChange{relative: node.relativePath(), node: node})
+		}
+		return nil
+	})
+}
+
+// remove record n and its descendants as removed. It should be called before n is unlinked.
+func (c *noteChanges) remove(n *NoteTreeNode) {
+	_ = n.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir {
+			c.removed = append(c.removed, node.relativePath())
+		}
+		return nil
+	})
+}
+
+// render record notes of n to be rendered.
+func (c *noteChanges) render(n *NoteTreeNode, overWrite bool) {
+	_ = n.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir {
+			c.pending = append(c.pending, pendingRender{node: node, overWrite: overWrite})
+		}
+		return nil
+	})
+}
+
+// relink record notes of n as their visibility changed.
+func (c *noteChanges) relink(n *NoteTreeNode) {
+	_ = n.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir {
+			c.relinked = append(c.relinked, strings.TrimPrefix(node.relativePath(), "/"))
+		}
+		return nil
+	})
+}
+
+// AddListener register l to be notified of changes of notes.
+// l would be notified of all notes already in tree at once.
+func (ns *fsNoteService) AddListener(l NoteListener) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	ns.listeners = append(ns.listeners, l)
+	all := &noteChanges{}
+	all.update(ns.root)
+	for _, change := range all.updated {
+		l.NoteUpdated(change.relative, change.node)
+	}
+}
+
+// notify dispatch changes to listeners. It should be called with ns.lock held.
+func (ns *fsNoteService) notify(changes *noteChanges) {
+	for _, l := range ns.listeners {
+		for _, relative := range changes.removed {
+			l.NoteRemoved(relative)
+		}
+		for _, change := range changes.updated {
+			l.NoteUpdated(change.relative, change.node)
+		}
+	}
+}
+
+// notifyAll notify listeners of all notes in tree as updated,
+// which is used after the tree is replaced.
+func (ns *fsNoteService) notifyAll() {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	all := &noteChanges{}
+	all.update(ns.root)
+	ns.notify(all)
+}
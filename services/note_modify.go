@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"go-blog/common"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Remove delete n from disk and the rendered cache, then unlink it from its parent.
+// Root can not be removed.
+func (n *NoteTreeNode) Remove() error {
+	if n.parent == nil {
+		return errors.New("can not remove root node")
+	}
+	err := os.RemoveAll(n.RawPath)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(n.RenderedPath)
+	if err != nil {
+		return err
+	}
+	delete(n.parent.Links, n.Name)
+	n.parent = nil
+	return nil
+}
+
+// Move move n into directory node dst, keeping its name.
+func (n *NoteTreeNode) Move(dst *NoteTreeNode) error {
+	return n.relocate(dst, n.Name)
+}
+
+// Rename rename n to name in its current directory.
+// Name of a note should keep the ".md" extension.
+func (n *NoteTreeNode) Rename(name string) error {
+	if n.parent == nil {
+		return errors.New("can not rename root node")
+	}
+	return n.relocate(n.parent, name)
+}
+
+// relocate move n to dst/name on disk and in the rendered cache,
+// then update the links and paths of n and its descendants.
+func (n *NoteTreeNode) relocate(dst *NoteTreeNode, name string) error {
+	if n.parent == nil {
+		return errors.New("can not move root node")
+	}
+	if !dst.IsDir {
+		return errors.New(dst.getPath() + " is not a directory")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return errors.New("invalid name: " + name)
+	}
+	if !n.IsDir && filepath.Ext(name) != ".md" {
+		return errors.New(name + " is not a markdown file name")
+	}
+	for p := dst; p != nil; p = p.parent {
+		if p == n {
+			return errors.New("can not move " + n.getPath() + " into itself")
+		}
+	}
+	if dst == n.parent && name == n.Name {
+		return nil
+	}
+	if dst.hasNode(name) || common.PathExists(filepath.Join(dst.RawPath, name)) {
+		return &common.ErrNodeExists{Relative: path.Join(dst.relativePath(), name)}
+	}
+
+	rawPath := filepath.Join(dst.RawPath, name)
+	renderedPath := filepath.Join(dst.RenderedPath, name)
+	if !n.IsDir {
+		renderedPath = common.ChExt(renderedPath, ".html")
+	}
+
+	err := os.Rename(n.RawPath, rawPath)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(n.RenderedPath); err == nil {
+		err = os.MkdirAll(dst.RenderedPath, os.ModePerm)
+		if err == nil {
+			err = os.Rename(n.RenderedPath, renderedPath)
+		}
+		if err != nil {
+			// Drop the rendered files rather than leaving them at a wrong place,
+			// they would be rendered again on next refresh.
+			log.Warn("Error when move rendered files of ", n.getPath(), ": ", err)
+			_ = os.RemoveAll(n.RenderedPath)
+		}
+	}
+
+	delete(n.parent.Links, n.Name)
+	n.Name = name
+	n.parent = dst
+	dst.Links[name] = n
+	n.rebase(rawPath, renderedPath)
+	return nil
+}
+
+// rebase set the paths of n and update its descendants accordingly.
+func (n *NoteTreeNode) rebase(rawPath string, renderedPath string) {
+	n.RawPath = rawPath
+	n.RenderedPath = renderedPath
+	// Descendants left in store have the old paths, so they are loaded before updated.
+	n.loadChildren()
+	for name, child := range n.Links {
+		childRendered := filepath.Join(renderedPath, name)
+		if !child.IsDir {
+			childRendered = common.ChExt(childRendered, ".html")
+		}
+		child.rebase(filepath.Join(rawPath, name), childRendered)
+	}
+}
+
+func (ns *fsNoteService) Remove(relative string) error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	node := ns.root.walkTo(strings.Split(relative, "/"), 0)
+	if node == nil {
+		return &common.ErrNoSuchNode{Relative: relative}
+	}
+	changes := &noteChanges{}
+	changes.remove(node)
+	err := node.Remove()
+	if err != nil {
+		return err
+	}
+	ns.renderAgain(changes)
+	ns.notify(changes)
+	return nil
+}
+
+// relocate call op which moves node, and notify listeners
+// that notes under node are moved if it succeed.
+func (ns *fsNoteService) relocate(node *NoteTreeNode, op func() error) error {
+	changes := &noteChanges{}
+	changes.remove(node)
+	err := op()
+	if err != nil {
+		return err
+	}
+	changes.update(node)
+	// Relative links in notes moved are resolved from their new directory.
+	changes.linked = true
+	changes.render(node, true)
+	ns.renderAgain(changes)
+	ns.notify(changes)
+	return nil
+}
+
+func (ns *fsNoteService) Move(relative string, dstDir string) error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	node := ns.root.walkTo(strings.Split(relative, "/"), 0)
+	if node == nil {
+		return &common.ErrNoSuchNode{Relative: relative}
+	}
+	dst := ns.root.walkTo(strings.Split(dstDir, "/"), 0)
+	if dst == nil {
+		return &common.ErrNoSuchNode{Relative: dstDir}
+	}
+	return ns.relocate(node, func() error {
+		return node.Move(dst)
+	})
+}
+
+func (ns *fsNoteService) Rename(relative string, name string) error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	node := ns.root.walkTo(strings.Split(relative, "/"), 0)
+	if node == nil {
+		return &common.ErrNoSuchNode{Relative: relative}
+	}
+	return ns.relocate(node, func() error {
+		return node.Rename(name)
+	})
+}
+
+// renderAgain render notes affected by changes with renderPending, and log the failures,
+// which do not fail the operation already done.
+func (ns *fsNoteService) renderAgain(changes *noteChanges) {
+	failures := &common.ErrFailures{}
+	ns.renderPending(changes, failures)
+	if err := failures.ErrOrNil(); err != nil {
+		log.Warn("Error when render notes again: ", err)
+	}
+}
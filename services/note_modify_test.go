@@ -0,0 +1,198 @@
+package services
+
+import (
+	"go-blog/common"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestModifyNotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(ns *fsNoteService) error
+		tree     []string // Tree after modification.
+		files    []string // Files expected on disk, relative to notes root.
+		rendered []string // Files expected in cache.
+		gone     []string // Files expected to be gone from notes root.
+		stale    []string // Files expected to be gone from cache.
+	}{
+		{
+			name:     "remove note",
+			modify:   func(ns *fsNoteService) error { return ns.Remove("/a.md") },
+			tree:     []string{"dir", "dir/b.md", "dir/sub", "dir/sub/c.md", "other"},
+			gone:     []string{"a.md"},
+			stale:    []string{"a.html"},
+			rendered: []string{"dir/b.html"},
+		},
+		{
+			name:   "remove directory",
+			modify: func(ns *fsNoteService) error { return ns.Remove("/dir") },
+			tree:   []string{"a.md", "other"},
+			gone:   []string{"dir/b.md", "dir/sub/c.md"},
+			stale:  []string{"dir/b.html", "dir/sub/c.html"},
+		},
+		{
+			name:     "move note",
+			modify:   func(ns *fsNoteService) error { return ns.Move("/a.md", "/other") },
+			tree:     []string{"dir", "dir/b.md", "dir/sub", "dir/sub/c.md", "other", "other/a.md"},
+			files:    []string{"other/a.md"},
+			rendered: []string{"other/a.html"},
+			gone:     []string{"a.md"},
+			stale:    []string{"a.html"},
+		},
+		{
+			name:     "move directory",
+			modify:   func(ns *fsNoteService) error { return ns.Move("/dir/sub", "/other") },
+			tree:     []string{"a.md", "dir", "dir/b.md", "other", "other/sub", "other/sub/c.md"},
+			files:    []string{"other/sub/c.md"},
+			rendered: []string{"other/sub/c.html"},
+			gone:     []string{"dir/sub/c.md"},
+			stale:    []string{"dir/sub/c.html"},
+		},
+		{
+			name:     "rename note",
+			modify:   func(ns *fsNoteService) error { return ns.Rename("/dir/b.md", "renamed.md") },
+			tree:     []string{"a.md", "dir", "dir/renamed.md", "dir/sub", "dir/sub/c.md", "other"},
+			files:    []string{"dir/renamed.md"},
+			rendered: []string{"dir/renamed.html"},
+			gone:     []string{"dir/b.md"},
+			stale:    []string{"dir/b.html"},
+		},
+		{
+			name:     "rename directory",
+			modify:   func(ns *fsNoteService) error { return ns.Rename("/dir", "renamed") },
+			tree:     []string{"a.md", "other", "renamed", "renamed/b.md", "renamed/sub", "renamed/sub/c.md"},
+			files:    []string{"renamed/sub/c.md"},
+			rendered: []string{"renamed/sub/c.html"},
+			gone:     []string{"dir/b.md"},
+			stale:    []string{"dir/b.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, root, cache := newTestNotes(t, map[string]string{
+				"a.md":         "# A\n",
+				"dir/b.md":     "# B\n",
+				"dir/sub/c.md": "# C\n",
+				"other/.keep":  "",
+			})
+			if err := ns.LoadFromDisk(); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.modify(ns); err != nil {
+				t.Fatal(err)
+			}
+			if got := treePaths(ns.root, ""); !reflect.DeepEqual(got, tt.tree) {
+				t.Errorf("tree = %q, want %q", got, tt.tree)
+			}
+			for _, f := range tt.files {
+				if !common.FileExist(filepath.Join(root, f)) {
+					t.Errorf("%s is not in notes root", f)
+				}
+			}
+			for _, f := range tt.rendered {
+				if !common.FileExist(filepath.Join(cache, f)) {
+					t.Errorf("%s is not in cache", f)
+				}
+			}
+			for _, f := range tt.gone {
+				if common.PathExists(filepath.Join(root, f)) {
+					t.Errorf("%s is not removed from notes root", f)
+				}
+			}
+			for _, f := range tt.stale {
+				if common.PathExists(filepath.Join(cache, f)) {
+					t.Errorf("%s is not removed from cache", f)
+				}
+			}
+			// Paths of moved nodes and their descendants follow their new place.
+			for _, relative := range tt.tree {
+				node := ns.Fetch("/"+relative, false)
+				if want := filepath.Join(root, filepath.FromSlash(relative)); node.RawPath != want {
+					t.Errorf("RawPath of %s = %s, want %s", relative, node.RawPath, want)
+				}
+			}
+		})
+	}
+}
+
+func TestModifyNotesInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(ns *fsNoteService) error
+	}{
+		{"remove root", func(ns *fsNoteService) error { return ns.Remove("/") }},
+		{"remove missing", func(ns *fsNoteService) error { return ns.Remove("/missing.md") }},
+		{"move into file", func(ns *fsNoteService) error { return ns.Move("/a.md", "/dir/b.md") }},
+		{"move into itself", func(ns *fsNoteService) error { return ns.Move("/dir", "/dir/sub") }},
+		{"move onto existing", func(ns *fsNoteService) error { return ns.Move("/b.md", "/dir") }},
+		{"rename to existing", func(ns *fsNoteService) error { return ns.Rename("/a.md", "b.md") }},
+		{"rename without extension", func(ns *fsNoteService) error { return ns.Rename("/a.md", "a") }},
+		{"rename with slash", func(ns *fsNoteService) error { return ns.Rename("/a.md", "sub/a.md") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, root, _ := newTestNotes(t, map[string]string{
+				"a.md":         "# A\n",
+				"b.md":         "# B\n",
+				"dir/b.md":     "# B\n",
+				"dir/sub/c.md": "# C\n",
+			})
+			if err := ns.LoadFromDisk(); err != nil {
+				t.Fatal(err)
+			}
+			before := treePaths(ns.root, "")
+			if err := tt.modify(ns); err == nil {
+				t.Error("modification succeeded, want error")
+			}
+			if got := treePaths(ns.root, ""); !reflect.DeepEqual(got, before) {
+				t.Errorf("tree = %q, want it unchanged %q", got, before)
+			}
+			if !common.FileExist(filepath.Join(root, "a.md")) {
+				t.Error("a.md is changed on disk")
+			}
+		})
+	}
+}
+
+func TestModifyNotesRenderLinking(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(ns *fsNoteService) error
+		broken []string // Broken links of a.md after modification, wikilinks first.
+	}{
+		{"remove", func(ns *fsNoteService) error { return ns.Remove("/dir/b.md") }, []string{"[[b]]", "dir/b.md"}},
+		{"move", func(ns *fsNoteService) error { return ns.Move("/dir/b.md", "/other") }, []string{"dir/b.md"}},
+		{"rename", func(ns *fsNoteService) error { return ns.Rename("/dir/b.md", "renamed.md") }, []string{"[[b]]", "dir/b.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, _, cache := newTestNotes(t, map[string]string{
+				"a.md":       "[B](dir/b.md) [[b]]\n",
+				"c.md":       "# C\n",
+				"dir/b.md":   "# B\n",
+				"other/d.md": "# D\n",
+			})
+			if err := ns.LoadFromDisk(); err != nil {
+				t.Fatal(err)
+			}
+			if a := ns.Fetch("/a.md", false); len(a.BrokenLinks) != 0 {
+				t.Fatalf("BrokenLinks of a.md = %q before modification, want none", a.BrokenLinks)
+			}
+			markRendered(t, cache, "a.html", "c.html")
+			if err := tt.modify(ns); err != nil {
+				t.Fatal(err)
+			}
+			if !isRenderedAgain(t, cache, "a.html") {
+				t.Error("a.md linking to the modified note is not rendered again")
+			}
+			if isRenderedAgain(t, cache, "c.html") {
+				t.Error("c.md is rendered again though it links to nothing")
+			}
+			if got := ns.Fetch("/a.md", false).BrokenLinks; !reflect.DeepEqual(got, tt.broken) {
+				t.Errorf("BrokenLinks of a.md = %q, want %q", got, tt.broken)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"go-blog/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// scan synchronizes the children of directory node n with its RawPath on disk.
+// Sub directories and markdown files found on disk would be linked into the tree,
+// nodes whose source disappeared would be unlinked and their rendered files removed if rendering.
+// If option.Recursive is true, sub directories would be scanned recursively.
+// If option.Render is true, markdown files would be rendered into RenderedPath.
+// Rendered files would only be replaced if option.OverWrite is true,
+// their source changed since last render or they do not exist.
+// If option.CopyOthers is true, non-markdown files would be copied to the cache directory while rendering.
+// Failures of single files are recorded in failures instead of stopping the scan.
+// Notes unlinked are recorded in changes, so are notes to be rendered,
+// which are rendered by fsNoteService.renderPending once the tree is synchronized.
+func (n *NoteTreeNode) scan(option *RefreshOption, failures *common.ErrFailures, changes *noteChanges) {
+	if !n.IsDir {
+		if option.Render {
+			changes.render(n, option.OverWrite)
+		}
+		return
+	}
+
+	n.loadChildren()
+	if option.Render && !common.DirectoryExist(n.RenderedPath) {
+		err := os.MkdirAll(n.RenderedPath, os.ModePerm)
+		if err != nil {
+			failures.Add(n.RenderedPath, err)
+			return
+		}
+	}
+
+	visibility, err := n.readDirVisibility()
+	failures.Add(filepath.Join(n.RawPath, DirSettingsFile), err)
+	if visibility != n.Visibility {
+		changes.relink(n)
+	}
+	n.Visibility = visibility
+
+	entries, err := ioutil.ReadDir(n.RawPath)
+	if err != nil {
+		failures.Add(n.RawPath, err)
+		return
+	}
+
+	found := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || entry.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if !entry.IsDir() && filepath.Ext(name) != ".md" {
+			if option.Render && option.CopyOthers {
+				dst := filepath.Join(n.RenderedPath, name)
+				if option.OverWrite || !common.FileExist(dst) {
+					failures.Add(filepath.Join(n.RawPath, name), common.CopyFile(filepath.Join(n.RawPath, name), dst))
+				}
+			}
+			continue
+		}
+
+		found[name] = true
+		child, ok := n.Links[name]
+		if ok && child.IsDir != entry.IsDir() {
+			// The type of entry changed since last scan.
+			changes.remove(child)
+			delete(n.Links, name)
+			ok = false
+		}
+		if !ok {
+			child, err = n.deriveNode(name, name, true)
+			if err != nil {
+				failures.Add(filepath.Join(n.RawPath, name), err)
+				continue
+			}
+			changes.linked = true
+		}
+		child.ModTime = entry.ModTime()
+
+		if !child.IsDir || option.Recursive {
+			child.scan(option, failures, changes)
+		}
+	}
+
+	for name, child := range n.Links {
+		if !found[name] {
+			changes.remove(child)
+			delete(n.Links, name)
+			if option.Render {
+				// Drop stale rendered files of vanished source.
+				failures.Add(child.RenderedPath, os.RemoveAll(child.RenderedPath))
+			}
+		}
+	}
+}
+
+// render renders the markdown file of n into its RenderedPath, resolving links to other notes with links.
+// Existing rendered file would be kept unless overWrite is true,
+// the source changed since last render or the markdown renderer changed.
+// It return whether the file is rendered.
+func (n *NoteTreeNode) render(overWrite bool, links *common.MdLinks) (bool, error) {
+	hash, err := common.HashFile(n.RawPath)
+	if err != nil {
+		return false, err
+	}
+	renderer := common.CurrentMdRenderer()
+	sig := renderSig(renderer, links)
+	if !overWrite && hash == n.Hash && sig == n.RenderSig && common.FileExist(n.RenderedPath) {
+		return false, nil
+	}
+	res, err := renderer.RenderNote(n.RawPath, n.RenderedPath, links)
+	if err != nil {
+		return false, err
+	}
+	n.Meta = res.Meta
+	if n.Meta != nil {
+		if _, ok := NormalizeVisibility(n.Meta.Visibility); !ok {
+			log.Warn("Unknown visibility ", n.Meta.Visibility, " of ", n.RawPath, ", it is taken as private.")
+		}
+	}
+	n.Abstract = res.Abstract
+	n.HasMath = res.Math
+	n.Toc = res.Toc
+	n.LinksTo = res.Links
+	n.BrokenLinks = res.BrokenLinks
+	if len(res.BrokenLinks) > 0 {
+		log.Warn("Broken links in ", n.RawPath, ": ", strings.Join(res.BrokenLinks, ", "))
+	}
+	n.Hash = hash
+	n.RenderSig = sig
+	n.RenderTime = time.Now()
+	return true, nil
+}
+
+// renderSig return the signature of rendering with renderer and links,
+// which changes if either the markdown renderer or the urls of notes linked change.
+func renderSig(renderer *common.MdRenderer, links *common.MdLinks) string {
+	if links == nil || links.URL == nil {
+		return renderer.Signature()
+	}
+	return common.HashBytes([]byte(renderer.Signature() + "\x00" + links.URL("")))
+}
+
+// DefaultNoteURL return the url of note with relative path served by this site under /notes.
+func DefaultNoteURL(relative string) string {
+	return "/notes/" + common.EscapePath(relative)
+}
+
+// links return the resolver of links in note n, which link to the urls built by noteURL,
+// or DefaultNoteURL if it is nil.
+// Wikilinks are resolved with names, which are collected from the tree of n if it is nil.
+// Notes which can not be seen by everyone who can see n are not linked, see canLink.
+func (n *NoteTreeNode) links(names map[string]string, noteURL func(relative string) string) *common.MdLinks {
+	root := n.root()
+	if names == nil {
+		names = root.noteNames()
+	}
+	if noteURL == nil {
+		noteURL = DefaultNoteURL
+	}
+	links := &common.MdLinks{
+		Root:  root.RawPath,
+		Note:  n.RawPath,
+		URL:   noteURL,
+		Names: names,
+	}
+	links.Visible = func(target string) bool {
+		node := root.walkTo(strings.Split(target, "/"), 0)
+		if node == nil {
+			return false
+		}
+		// Front matter of n is not kept in n until it is rendered.
+		visibility := InheritVisibility(metaVisibility(links.Meta), n.parent.effectiveVisibility())
+		return canLink(visibility, node.effectiveVisibility())
+	}
+	return links
+}
+
+// noteNames return common.MdNoteNames of notes in the tree of n.
+func (n *NoteTreeNode) noteNames() map[string]string {
+	var paths []string
+	_ = n.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir {
+			paths = append(paths, strings.TrimPrefix(node.relativePath(), "/"))
+		}
+		return nil
+	})
+	return common.MdNoteNames(paths)
+}
+
+// renderPending render the notes recorded by scan in changes once the tree is synchronized with disk,
+// so that links between notes are resolved with all notes in tree.
+// Notes linking to notes removed or whose visibility changed are rendered again,
+// and so are notes with broken links if notes are linked into tree, so that their links are not left stale.
+// It should be called with lock of tree held.
+func (ns *fsNoteService) renderPending(changes *noteChanges, failures *common.ErrFailures) {
+	if changes.linked || len(changes.removed) > 0 {
+		ns.names = nil
+	}
+	if len(changes.pending) == 0 && len(changes.removed) == 0 && len(changes.relinked) == 0 && !changes.linked {
+		return
+	}
+	if ns.names == nil {
+		ns.names = ns.root.noteNames()
+	}
+	render := func(n *NoteTreeNode, overWrite bool) {
+		visibility := n.effectiveVisibility()
+		rendered, err := n.render(overWrite, n.links(ns.names, ns.noteURL))
+		failures.Add(n.RawPath, err)
+		if rendered {
+			changes.update(n)
+			if n.effectiveVisibility() != visibility {
+				changes.relink(n)
+			}
+		}
+	}
+	for _, p := range changes.pending {
+		render(p.node, p.overWrite)
+	}
+	changes.pending = nil
+
+	stale := make(map[string]bool)
+	for _, relative := range changes.removed {
+		stale[strings.TrimPrefix(relative, "/")] = true
+	}
+	for _, relative := range changes.relinked {
+		stale[relative] = true
+	}
+	retry := changes.linked || len(changes.relinked) > 0
+	changes.linked = false
+	changes.relinked = nil
+	_ = ns.root.walk(func(node *NoteTreeNode) error {
+		if node.IsDir {
+			return nil
+		}
+		if retry && len(node.BrokenLinks) > 0 {
+			render(node, true)
+			return nil
+		}
+		for _, target := range node.LinksTo {
+			if stale[target] {
+				render(node, true)
+				break
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"go-blog/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeNotes create files with contents under root, making directories as needed.
+func writeNotes(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newTestNotes create a note service over a temporary notes root with files,
+// rendering into a temporary cache directory and keeping its index in another one.
+func newTestNotes(t *testing.T, files map[string]string) (ns *fsNoteService, root string, cache string) {
+	root, cache = t.TempDir(), t.TempDir()
+	writeNotes(t, root, files)
+	ns = NewFsNoteService(cache, root).(*fsNoteService)
+	ns.indexPath = filepath.Join(t.TempDir(), "notes.json")
+	setSearchIndex(ns, newSearchIndex(filepath.Join(t.TempDir(), "search.idx")))
+	return ns, root, cache
+}
+
+// treePaths list the relative paths of all nodes under n, sorted.
+func treePaths(n *NoteTreeNode, prefix string) []string {
+	var res []string
+	for name, child := range n.Links {
+		res = append(res, prefix+name)
+		res = append(res, treePaths(child, prefix+name+"/")...)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestLoadFromDisk(t *testing.T) {
+	ns, _, cache := newTestNotes(t, map[string]string{
+		"a.md":         "# A\n",
+		"dir/b.md":     "# B\n",
+		"dir/sub/c.md": "# C\n",
+		"dir/img.png":  "png",
+		".hidden/d.md": "# D\n",
+		"readme.txt":   "text",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.md", "dir", "dir/b.md", "dir/sub", "dir/sub/c.md"}
+	if got := treePaths(ns.root, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %q, want %q", got, want)
+	}
+	for _, rendered := range []string{"a.html", "dir/b.html", "dir/sub/c.html", "dir/img.png", "readme.txt"} {
+		if !common.FileExist(filepath.Join(cache, rendered)) {
+			t.Errorf("%s is not in cache", rendered)
+		}
+	}
+}
+
+func TestLoadFromDiskFailures(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, root string, cache string) string // Break a note and return the path failed.
+	}{
+		{
+			name: "unreadable source",
+			setup: func(t *testing.T, root string, cache string) string {
+				p := filepath.Join(root, "bad.md")
+				if err := os.Chmod(p, 0); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := ioutil.ReadFile(p); err == nil {
+					t.Skip("files without permission are still readable by root")
+				}
+				return p
+			},
+		},
+		{
+			name: "unwritable rendered file",
+			setup: func(t *testing.T, root string, cache string) string {
+				// A directory in place of the rendered file can not be written.
+				if err := os.MkdirAll(filepath.Join(cache, "bad.html"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				return filepath.Join(root, "bad.md")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, root, cache := newTestNotes(t, map[string]string{
+				"bad.md":   "# Bad\n",
+				"good.md":  "# Good\n",
+				"dir/c.md": "# C\n",
+			})
+			failed := tt.setup(t, root, cache)
+			err := ns.LoadFromDisk()
+			failures, ok := err.(*common.ErrFailures)
+			if !ok {
+				t.Fatalf("LoadFromDisk() error = %v, want *common.ErrFailures", err)
+			}
+			if len(failures.Failures) != 1 || failures.Failures[failed] == nil {
+				t.Errorf("Failures = %v, want only %s", failures.Failures, failed)
+			}
+			// Other notes are still loaded and rendered.
+			for _, rendered := range []string{"good.html", "dir/c.html"} {
+				if !common.FileExist(filepath.Join(cache, rendered)) {
+					t.Errorf("%s is not rendered", rendered)
+				}
+			}
+			if ns.Fetch("/bad.md", false) == nil {
+				t.Error("failed note is not in tree")
+			}
+		})
+	}
+}
+
+func TestRefreshRemovesVanished(t *testing.T) {
+	ns, root, _ := newTestNotes(t, map[string]string{
+		"a.md":     "# A\n",
+		"dir/b.md": "# B\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	writeNotes(t, root, map[string]string{"new.md": "# New\n"})
+	if err := ns.Refresh("/", &RefreshOption{Recursive: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.md", "new.md"}
+	if got := treePaths(ns.root, ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("tree = %q, want %q", got, want)
+	}
+}
+
+func TestRenderFrontMatter(t *testing.T) {
+	ns, _, cache := newTestNotes(t, map[string]string{
+		"a.md": "---\ntitle: Hello\ntags: [go, blog]\ndate: 2021-06-01\n---\n# Body\n",
+		"b.md": "# No front matter\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	a := ns.Fetch("/a.md", true)
+	if a.Meta == nil || a.Meta.Title != "Hello" || !reflect.DeepEqual(a.Meta.Tags, []string{"go", "blog"}) {
+		t.Errorf("Meta = %+v, want title and tags of front matter", a.Meta)
+	}
+	html, err := ioutil.ReadFile(filepath.Join(cache, "a.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(html) != "<h1 id=\"body\">Body</h1>\n" {
+		t.Errorf("rendered = %q, want front matter stripped", html)
+	}
+	if b := ns.Fetch("/b.md", true); b.Meta != nil {
+		t.Errorf("Meta of note without front matter = %+v, want nil", b.Meta)
+	}
+}
+
+func TestRenderBrokenFrontMatter(t *testing.T) {
+	ns, root, cache := newTestNotes(t, map[string]string{
+		"a.md": "---\ntitle: Hello\n---\n# Body\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	rendered, err := ioutil.ReadFile(filepath.Join(cache, "a.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeNotes(t, root, map[string]string{"a.md": "---\ntitle: [Hello\n---\n# Changed\n"})
+	err = ns.Refresh("/", &RefreshOption{Render: true})
+	if failures, ok := err.(*common.ErrFailures); !ok || failures.Failures[filepath.Join(root, "a.md")] == nil {
+		t.Fatalf("Refresh() error = %v, want failure of a.md", err)
+	}
+	// The note keeps what it was rendered last time.
+	if a := ns.Fetch("/a.md", false); a.Meta == nil || a.Meta.Title != "Hello" {
+		t.Errorf("Meta = %+v, want the one before front matter broke", a.Meta)
+	}
+	if html, _ := ioutil.ReadFile(filepath.Join(cache, "a.html")); string(html) != string(rendered) {
+		t.Errorf("rendered = %q, want %q kept", html, rendered)
+	}
+}
+
+func TestRenderNoteURL(t *testing.T) {
+	ns, _, cache := newTestNotes(t, map[string]string{
+		"a.md":           "[B](dir/my%20note.md) [C](c%231.md)\n",
+		"dir/my note.md": "# B\n",
+		"c#1.md":         "# C\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	want := `<p><a href="/notes/dir/my%20note.md">B</a> <a href="/notes/c%231.md">C</a></p>` + "\n"
+	if html, _ := ioutil.ReadFile(filepath.Join(cache, "a.html")); string(html) != want {
+		t.Errorf("rendered = %q, want %q", html, want)
+	}
+	if err := ns.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Notes are rendered again with urls built by another builder.
+	reloaded := reopen(ns)
+	reloaded.SetNoteURL(func(relative string) string {
+		return "http://example.com" + DefaultNoteURL(relative)
+	})
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	want = `<p><a href="http://example.com/notes/dir/my%20note.md">B</a> <a href="http://example.com/notes/c%231.md">C</a></p>` + "\n"
+	if html, _ := ioutil.ReadFile(filepath.Join(cache, "a.html")); string(html) != want {
+		t.Errorf("rendered with builder = %q, want %q", html, want)
+	}
+}
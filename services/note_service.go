@@ -7,9 +7,11 @@ import (
 	"go-blog/common"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 var log = logging.Logger("services")
@@ -19,12 +21,71 @@ var log = logging.Logger("services")
 type NoteService interface {
 	// Fetch fetch a node with relative path.
 	// It would return a copy of original node with limited node info if copy is true.
+	// Front matter of a note is kept in Meta of the node.
 	Fetch(relative string, copy bool) *NoteTreeNode	// Return nil if not found.
 
 	// FetchAll is equal to call Fetch with "relative=/" and "copy=false".
 	FetchAll() *NoteTreeNode
+
+	// Refresh rescan the node with relative path from disk.
+	// Errors of single files would be returned together as *common.ErrFailures
+	// after all other files are processed.
+	Refresh(relative string, option *RefreshOption) error
+
+	// Render link the note or directory with relative path into tree if it is not,
+	// then render it even if it is not changed. A light copy of the node is returned.
+	Render(relative string) (*NoteTreeNode, error)
+
+	// LoadFromDisk restore the tree from the index written by WriteBack if there is one,
+	// then call Refresh with "relative=/" and DefaultLoadOption.
+	// Only notes changed since the index was written would be rendered again.
 	LoadFromDisk() error
 	WriteBack() error	// Write the note service to store.
+
+	// Remove delete the note or directory with relative path from disk and rendered cache.
+	Remove(relative string) error
+	// Move move the node with relative path into directory dstDir.
+	Move(relative string, dstDir string) error
+	// Rename rename the node with relative path to name in its directory.
+	Rename(relative string, name string) error
+
+	// AddListener register a listener notified of changes of notes.
+	AddListener(l NoteListener)
+
+	// SetNoteURL set the builder of urls of notes from their relative paths, which links between notes link to.
+	// DefaultNoteURL is used if it is not set. It should be called before LoadFromDisk,
+	// notes rendered with urls built by another builder would be rendered again by it.
+	SetNoteURL(noteURL func(relative string) string)
+
+	// Visibility return the visibility of the note or directory with relative path,
+	// inherited from its ancestors. Paths not in tree get the visibility of their deepest ancestor in tree.
+	Visibility(relative string) string
+
+	// Methods below only return notes listed for users with role, see IsListed.
+	// role is empty for visitors not logged in.
+
+	// Tags return all tags in front matter of notes with the number of notes.
+	Tags(role string) []TagCount
+	// Categories return all categories in front matter of notes with the number of notes.
+	Categories(role string) []TagCount
+	// NotesOfTag return notes with tag, newest first.
+	NotesOfTag(tag string, role string) []NoteRef
+	// NotesOfCategory return notes in category, newest first.
+	NotesOfCategory(category string, role string) []NoteRef
+
+	// RecentNotes return at most limit notes from offset, newest first, and the number of all notes.
+	// Pinned notes are not included.
+	RecentNotes(offset int, limit int, role string) ([]NoteRef, int)
+	// PinnedNotes return notes pinned by front matter, newest first.
+	PinnedNotes(role string) []NoteRef
+
+	// Search return at most limit notes matching query, best first.
+	Search(query string, limit int, role string) []SearchResult
+
+	// Watch start watching the notes root. New, changed and removed notes would be
+	// applied to the tree and rendered cache automatically. Call StopWatch to stop it.
+	Watch() error
+	StopWatch()
 	// Upload
 	// WriteBack
 }
@@ -38,6 +99,19 @@ type NoteTreeNode struct {
 	RawPath string
 	RenderedPath string
 	Abstract string
+	RenderTime time.Time // Time of last render. Zero if never rendered.
+	Hash string          // Hex sha256 of the source when last rendered.
+	RenderSig string `json:",omitempty"` // Signature of markdown renderer and urls of links when last rendered, see renderSig.
+	ModTime time.Time    // Modification time of the source when last scanned.
+	Meta *common.FrontMatter `json:",omitempty"` // Front matter of note. nil if not rendered or it has none.
+	Visibility string `json:",omitempty"` // Visibility in settings file of directory. Use OwnVisibility for notes.
+	HasMath bool `json:",omitempty"`       // Whether the rendered note contains math.
+	Toc []*common.TocItem `json:",omitempty"` // Table of contents of the rendered note.
+	LinksTo []string `json:",omitempty"`      // Paths of notes linked when last rendered, relative to notes root.
+	BrokenLinks []string `json:",omitempty"`  // Links to notes not found when last rendered.
+
+	lazy *lazyChildren // Children kept in store and not linked yet. nil if there is none.
+	storeSig string    // Signature of the entry of node in store, empty if it is not in store.
 }
 
 type RefreshOption struct {
@@ -54,6 +128,13 @@ var DefaultAddOption = &RefreshOption{
 	CopyOthers: true,
 }
 
+var DefaultLoadOption = &RefreshOption{
+	Recursive:  true,
+	Render:     true,
+	OverWrite:  false,
+	CopyOthers: true,
+}
+
 func (n *NoteTreeNode) ToJsonString() string {
 	res, err := json.MarshalIndent(n, "", "\t")
 	if err != nil {
@@ -86,7 +167,40 @@ func (n *NoteTreeNode) LightCopy() *NoteTreeNode {
 		RawPath:      n.RawPath,
 		RenderedPath: n.RenderedPath,
 		Abstract:     n.Abstract,
+		RenderTime:   n.RenderTime,
+		Hash:         n.Hash,
+		RenderSig:    n.RenderSig,
+		ModTime:      n.ModTime,
+		Meta:         n.Meta,
+		Visibility:   n.Visibility,
+		HasMath:      n.HasMath,
+		Toc:          n.Toc,
+		LinksTo:      n.LinksTo,
+		BrokenLinks:  n.BrokenLinks,
+	}
+}
+
+// Date return the created date in front matter,
+// or the modification time of source if there is none.
+func (n *NoteTreeNode) Date() time.Time {
+	if n.Meta != nil && !n.Meta.Date.IsZero() {
+		return n.Meta.Date
 	}
+	return n.ModTime
+}
+
+// Pinned report whether the note is pinned to the top of home page by front matter.
+func (n *NoteTreeNode) Pinned() bool {
+	return n.Meta != nil && n.Meta.Pinned
+}
+
+// Title return the title in front matter,
+// or the name without extension if there is none.
+func (n *NoteTreeNode) Title() string {
+	if n.Meta != nil && n.Meta.Title != "" {
+		return n.Meta.Title
+	}
+	return strings.TrimSuffix(n.Name, filepath.Ext(n.Name))
 }
 
 // Add add a new node for node n from a relative path.
@@ -110,7 +224,7 @@ func (n *NoteTreeNode) Add(relative string, name string, option *RefreshOption)
 	if len(entries) > 1 {
 		for _, entry := range entries[0 : len(entries)-1] {
 			if entry != "" {
-				tmpNode, ok = current.Links[entry]
+				tmpNode, ok = current.child(entry)
 				if !ok {
 					tmpNode, err = current.deriveNode(entry, entry, true)
 					if err != nil {
@@ -124,7 +238,7 @@ func (n *NoteTreeNode) Add(relative string, name string, option *RefreshOption)
 
 	entry := entries[len(entries)-1]
 	if entry != "" {
-		tmpNode, ok = current.Links[entry]
+		tmpNode, ok = current.child(entry)
 		if !ok {
 			tmpNode, err = current.deriveNode(entry, name, true)
 			if err != nil {
@@ -136,7 +250,8 @@ func (n *NoteTreeNode) Add(relative string, name string, option *RefreshOption)
 
 	if option.Render {
 		if !current.IsDir {
-			return common.MdRenderFile(current.RawPath, current.RenderedPath)
+			_, err = current.render(true, current.links(nil, nil))
+			return err
 		} else {
 			return os.Mkdir(current.RenderedPath, os.ModePerm)
 		}
@@ -187,10 +302,33 @@ func (n *NoteTreeNode) deriveNode(relativePath string, name string, link bool) (
 }
 
 func (n *NoteTreeNode) hasNode(name string) bool {
-	_, ok := n.Links[name]
+	_, ok := n.child(name)
 	return ok
 }
 
+// child return the child of n with name, which is loaded from store if it is not linked yet.
+func (n *NoteTreeNode) child(name string) (*NoteTreeNode, bool) {
+	n.loadChildren()
+	child, ok := n.Links[name]
+	return child, ok
+}
+
+// root return the root of tree n is linked into.
+func (n *NoteTreeNode) root() *NoteTreeNode {
+	for n.parent != nil {
+		n = n.parent
+	}
+	return n
+}
+
+// relativePath return the path of n relative to the root of tree, "/" for root.
+func (n *NoteTreeNode) relativePath() string {
+	if n.parent == nil {
+		return "/"
+	}
+	return path.Join(n.parent.relativePath(), n.Name)
+}
+
 func (n *NoteTreeNode) getPath() string {
 	if n.parent == nil {
 		return "/" + n.Name
@@ -202,13 +340,23 @@ func (n *NoteTreeNode) getPath() string {
 // Note Service implemented based on file system.
 // No database is required.
 type fsNoteService struct {
-	root *NoteTreeNode
+	root      *NoteTreeNode
+	indexPath string    // The tree is written back to and restored from it if there is no store.
+	store     NoteStore // Persistence layer of tree. Can be nil.
+	watcher   *noteWatcher
+	watchLock sync.Mutex
+	listeners []NoteListener
+	tags      *tagIndex
+	search    *SearchIndex
+	names     map[string]string // Names of notes in tree for wikilinks. nil if tree changed since built.
+	storeLock sync.Mutex        // Held while the tree is written into store.
+	noteURL   func(relative string) string // Build urls of notes linked by notes. nil for DefaultNoteURL.
 
 	lock sync.RWMutex
 }
 
 func NewFsNoteService(cacheDir string, rootDir string) NoteService {
-	return &fsNoteService{
+	ns := &fsNoteService{
 		root: &NoteTreeNode{
 			Links:        make(map[string]*NoteTreeNode),
 			parent:       nil,
@@ -218,8 +366,33 @@ func NewFsNoteService(cacheDir string, rootDir string) NoteService {
 			RenderedPath: cacheDir,
 			Abstract:     "",
 		},
-		lock: sync.RWMutex{},
+		indexPath: common.PathNoteIndex(),
+		lock:      sync.RWMutex{},
+		tags:      newTagIndex(),
 	}
+	search, err := OpenSearchIndex(common.PathSearchIndex())
+	if err != nil {
+		log.Warn("Error when open search index, notes would be indexed again: ", err)
+		search = newSearchIndex(common.PathSearchIndex())
+	}
+	ns.search = search
+	ns.listeners = append(ns.listeners, ns.tags, ns.search)
+	return ns
+}
+
+// NewFsNoteServiceWithStore create a note service which persist the tree with store
+// instead of an index file.
+// The store would not be closed by note service.
+func NewFsNoteServiceWithStore(cacheDir string, rootDir string, store NoteStore) NoteService {
+	ns := NewFsNoteService(cacheDir, rootDir).(*fsNoteService)
+	ns.store = store
+	return ns
+}
+
+func (ns *fsNoteService) SetNoteURL(noteURL func(relative string) string) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	ns.noteURL = noteURL
 }
 
 func (ns *fsNoteService) Fetch(relative string, copy bool) *NoteTreeNode {
@@ -227,6 +400,9 @@ func (ns *fsNoteService) Fetch(relative string, copy bool) *NoteTreeNode {
 	defer ns.lock.RUnlock()
 	entries := strings.Split(relative, "/")
 	rawNode := ns.root.walkTo(entries, 0)
+	if rawNode == nil {
+		return nil
+	}
 	if copy {
 		newNode := rawNode.LightCopy()
 		if rawNode.Links != nil {
@@ -253,24 +429,140 @@ func (n *NoteTreeNode) walkTo(entries []string, index int) *NoteTreeNode {
 	for index < len(entries) && entries[index] == "" {
 		index++
 	}
-	if index == len(entries) -1 {
+	n.loadChildren()
+	if index >= len(entries) {
 		return n
-	}else if index < len(entries) {
-		nextNode, ok := n.Links[entries[index]]
+	}
+	nextNode, ok := n.Links[entries[index]]
+	if !ok {
+		return nil
+	}
+	return nextNode.walkTo(entries, index+1)
+}
+
+func (ns *fsNoteService) Refresh(relative string, option *RefreshOption) error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	node := ns.root.walkTo(strings.Split(relative, "/"), 0)
+	if node == nil {
+		return &common.ErrNoSuchNode{Relative: relative}
+	}
+	failures := &common.ErrFailures{}
+	changes := &noteChanges{}
+	node.scan(option, failures, changes)
+	ns.renderPending(changes, failures)
+	ns.notify(changes)
+	return failures.ErrOrNil()
+}
+
+func (ns *fsNoteService) Render(relative string) (*NoteTreeNode, error) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+	changes := &noteChanges{}
+	defer ns.notify(changes)
+
+	// Link missing ancestors by scanning their parents, failures of other files are only logged.
+	node := ns.root
+	for _, entry := range strings.Split(relative, "/") {
+		if entry == "" {
+			continue
+		}
+		next, ok := node.child(entry)
 		if !ok {
-			return nil
-		} else {
-			return nextNode.walkTo(entries, index+1)
+			others := &common.ErrFailures{}
+			node.scan(watchOption, others, changes)
+			ns.renderPending(changes, others)
+			if err := others.ErrOrNil(); err != nil {
+				log.Warn("Error when scan ", node.getPath(), ": ", err)
+			}
+			next, ok = node.child(entry)
+			if !ok {
+				return nil, &common.ErrNoSuchNode{Relative: relative}
+			}
 		}
-	} else {
-		return nil
+		node = next
 	}
+
+	failures := &common.ErrFailures{}
+	node.scan(&RefreshOption{
+		Recursive:  true,
+		Render:     true,
+		OverWrite:  true,
+		CopyOthers: true,
+	}, failures, changes)
+	ns.renderPending(changes, failures)
+	return node.LightCopy(), failures.ErrOrNil()
 }
 
 func (ns *fsNoteService) LoadFromDisk() error {
-	return nil
+	err := ns.readIndex()
+	if err != nil {
+		// A broken index only costs a full render.
+		log.Warn("Error when read note index, all notes would be rendered again: ", err)
+	}
+	// Notes restored from index would not be rendered again, so notify all of them.
+	ns.notifyAll()
+	err = ns.Refresh("/", DefaultLoadOption)
+	if err != nil {
+		log.Error("Error when load notes from disk: ", err)
+	}
+	ns.search.Retain(ns.notePaths())
+	return err
 }
 
-func (ns *fsNoteService) WriteBack() error {
-	return nil
+func (ns *fsNoteService) Search(query string, limit int, role string) []SearchResult {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	return ns.search.SearchFiltered(query, limit, ns.listedFilter(role))
+}
+
+// notePaths return relative paths of all notes in tree.
+func (ns *fsNoteService) notePaths() map[string]bool {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	res := make(map[string]bool)
+	_ = ns.root.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir {
+			res[node.relativePath()] = true
+		}
+		return nil
+	})
+	return res
+}
+
+func (ns *fsNoteService) RecentNotes(offset int, limit int, role string) ([]NoteRef, int) {
+	refs := ns.collect(func(n *NoteTreeNode) bool {
+		return !n.Pinned() && IsListed(n.effectiveVisibility(), role)
+	})
+	total := len(refs)
+	if offset < 0 || offset >= total || limit <= 0 {
+		return []NoteRef{}, total
+	}
+	end := offset + limit
+	if end > total || end < offset {
+		end = total
+	}
+	return refs[offset:end], total
+}
+
+func (ns *fsNoteService) PinnedNotes(role string) []NoteRef {
+	return ns.collect(func(n *NoteTreeNode) bool {
+		return n.Pinned() && IsListed(n.effectiveVisibility(), role)
+	})
+}
+
+// collect return light copies of notes accepted by filter, newest first.
+// filter is called with lock of tree held.
+func (ns *fsNoteService) collect(filter func(*NoteTreeNode) bool) []NoteRef {
+	ns.lock.RLock()
+	var res []NoteRef
+	_ = ns.root.walk(func(node *NoteTreeNode) error {
+		if !node.IsDir && filter(node) {
+			res = append(res, NoteRef{Path: node.relativePath(), Note: node.LightCopy()})
+		}
+		return nil
+	})
+	ns.lock.RUnlock()
+	sortRefs(res)
+	return res
 }
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"fmt"
+	"go-blog/common"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNode create a node linked into parent, which is a directory if name has no extension.
+// Notes are taken as rendered with meta.
+func testNode(parent *NoteTreeNode, name string, meta *common.FrontMatter) *NoteTreeNode {
+	n := &NoteTreeNode{
+		Links: make(map[string]*NoteTreeNode),
+		IsDir: !strings.HasSuffix(name, ".md"),
+		Name:  name,
+		Meta:  meta,
+	}
+	if !n.IsDir {
+		n.RenderTime = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if parent != nil {
+		n.parent = parent
+		parent.Links[name] = n
+	}
+	return n
+}
+
+// newTestNoteService create a note service with notes n0.md to n4.md, newest first,
+// a pinned note, a draft and a private note, which are only kept in memory.
+func newTestNoteService() *fsNoteService {
+	root := testNode(nil, ".", nil)
+	base := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		testNode(root, fmt.Sprintf("n%d.md", i), &common.FrontMatter{Date: base.AddDate(0, 0, -i)})
+	}
+	testNode(root, "pinned.md", &common.FrontMatter{Date: base, Pinned: true})
+	testNode(root, "draft.md", &common.FrontMatter{Date: base.AddDate(0, 0, 1), Draft: true})
+	testNode(root, "private.md", &common.FrontMatter{Date: base.AddDate(0, 0, 2), Visibility: "private"})
+	return &fsNoteService{root: root}
+}
+
+// maxInt is the largest int, which overflows offset plus limit.
+const maxInt = int(^uint(0) >> 1)
+
+func TestRecentNotes(t *testing.T) {
+	ns := newTestNoteService()
+	tests := []struct {
+		name   string
+		offset int
+		limit  int
+		role   string
+		want   []string
+		total  int
+	}{
+		{"first page", 0, 2, "", []string{"/n0.md", "/n1.md"}, 5},
+		{"middle page", 2, 2, "", []string{"/n2.md", "/n3.md"}, 5},
+		{"last page", 4, 2, "", []string{"/n4.md"}, 5},
+		{"offset at end", 5, 2, "", nil, 5},
+		{"offset past end", 100, 2, "", nil, 5},
+		{"negative offset", -1, 2, "", nil, 5},
+		{"zero limit", 0, 0, "", nil, 5},
+		{"huge limit", 3, maxInt, "", []string{"/n3.md", "/n4.md"}, 5},
+		{"draft for editor", 0, 1, RoleEditor, []string{"/draft.md"}, 6},
+		{"private for admin", 0, 2, RoleAdmin, []string{"/private.md", "/draft.md"}, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, total := ns.RecentNotes(tt.offset, tt.limit, tt.role)
+			if got := refPaths(refs); !reflect.DeepEqual(got, tt.want) || total != tt.total {
+				t.Errorf("RecentNotes(%d, %d, %q) = %q, %d, want %q, %d",
+					tt.offset, tt.limit, tt.role, got, total, tt.want, tt.total)
+			}
+		})
+	}
+}
+
+func TestPinnedNotes(t *testing.T) {
+	ns := newTestNoteService()
+	if got := refPaths(ns.PinnedNotes("")); !reflect.DeepEqual(got, []string{"/pinned.md"}) {
+		t.Errorf("PinnedNotes() = %q, want only /pinned.md", got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	ns, root, cache := newTestNotes(t, map[string]string{"a.md": "# A\n"})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Notes are rendered again even if they are not changed.
+	markRendered(t, cache, "a.html")
+	node, err := ns.Render("/a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isRenderedAgain(t, cache, "a.html") || node.Name != "a.md" {
+		t.Errorf("Render() = %+v, want a.md rendered again", node)
+	}
+
+	// Notes not in tree yet are linked with their directories.
+	writeNotes(t, root, map[string]string{"dir/b.md": "# B\n"})
+	if _, err := ns.Render("/dir/b.md"); err != nil {
+		t.Fatal(err)
+	}
+	if ns.Fetch("/dir/b.md", false) == nil || !common.FileExist(filepath.Join(cache, "dir", "b.html")) {
+		t.Error("dir/b.md is not linked and rendered")
+	}
+
+	if _, err := ns.Render("/missing.md"); !isNoSuchNode(err) {
+		t.Errorf("Render() of missing note error = %v, want *common.ErrNoSuchNode", err)
+	}
+}
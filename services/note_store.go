@@ -1,9 +1,210 @@
 package services
 
-// TODO: Use Database to store Notes.
-//		 - Structure of entry: Child, Sibling, Infos
-//		 - Can be cached by in-memory NoteTreeNode.
+import (
+	"encoding/json"
+	"go-blog/common"
+	"path"
+	"strings"
+	"time"
 
+	bolt "go.etcd.io/bbolt"
+)
+
+// NoteStore is the persistence layer of note service.
+// Entries are the infos of NoteTreeNode without links, keyed by the relative path
+// from notes root. The root itself is keyed by "/".
+// The tree structure is kept by the key: children of an entry can be listed
+// without loading the whole tree, so that it can be cached by in-memory NoteTreeNode.
+// NoteStore should be thread safe.
 type NoteStore interface {
+	Get(relative string) (*NoteTreeNode, error) // Return *common.ErrNoSuchNode if not found.
+	Put(relative string, node *NoteTreeNode) error
+	Delete(relative string) error               // Delete the entry and all its descendants.
+	Children(relative string) ([]string, error) // Return names of direct children.
+
+	// Iterate call fn with every entry in the store, parents before children.
+	// Iteration would stop at the first error returned by fn.
+	Iterate(fn func(relative string, node *NoteTreeNode) error) error
+	// Update call fn with a writer whose changes are committed at once if fn returns nil,
+	// or discarded if it returns an error. The writer should not be used after fn returns.
+	Update(fn func(w NoteStoreWriter) error) error
+	Close() error
+}
+
+// NoteStoreWriter change entries of NoteStore in a single transaction, see NoteStore.Update.
+type NoteStoreWriter interface {
+	Put(relative string, node *NoteTreeNode) error
+	Delete(relative string) error               // Delete the entry and all its descendants.
+	Children(relative string) ([]string, error) // Return names of direct children, including changes not committed.
+}
+
+var boltNoteBucket = []byte("notes")
+
+// NoteStore implemented based on bbolt.
+// All entries live in a single file.
+//
+// Key of an entry is its parent path and its name joined by '\x00',
+// which makes children of the same parent adjacent in the bucket.
+// Root is keyed by "/" since bbolt does not accept empty key:
+//
+//	"/"			-> "/"
+//	"/a"		-> "\x00a"
+//	"/a/b.md"	-> "a\x00b.md"
+type boltNoteStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltNoteStore open the store file filePath, which would be created if not exists.
+// Only one process can open the store at the same time.
+func OpenBoltNoteStore(filePath string) (NoteStore, error) {
+	db, err := bolt.Open(filePath, 0664, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltNoteBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltNoteStore{db: db}, nil
+}
+
+// cleanRelative return relative in form of "a/b", "" for root.
+func cleanRelative(relative string) string {
+	return strings.Trim(path.Clean("/"+relative), "/")
+}
+
+func storeKey(relative string) []byte {
+	relative = cleanRelative(relative)
+	if relative == "" {
+		return []byte("/")
+	}
+	dir, name := path.Split(relative)
+	return []byte(strings.TrimSuffix(dir, "/") + "\x00" + name)
+}
+
+func childPrefix(relative string) []byte {
+	return []byte(cleanRelative(relative) + "\x00")
+}
+
+func (s *boltNoteStore) Get(relative string) (*NoteTreeNode, error) {
+	var node *NoteTreeNode
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltNoteBucket).Get(storeKey(relative))
+		if data == nil {
+			return &common.ErrNoSuchNode{Relative: relative}
+		}
+		node = &NoteTreeNode{}
+		return json.Unmarshal(data, node)
+	})
+	if err != nil {
+		return nil, err
+	}
+	node.Links = make(map[string]*NoteTreeNode)
+	return node, nil
+}
+
+func (s *boltNoteStore) Put(relative string, node *NoteTreeNode) error {
+	return s.Update(func(w NoteStoreWriter) error {
+		return w.Put(relative, node)
+	})
+}
+
+func (s *boltNoteStore) Delete(relative string) error {
+	return s.Update(func(w NoteStoreWriter) error {
+		return w.Delete(relative)
+	})
+}
+
+func deleteRecursively(b *bolt.Bucket, relative string) error {
+	for _, name := range listChildren(b, relative) {
+		err := deleteRecursively(b, path.Join(relative, name))
+		if err != nil {
+			return err
+		}
+	}
+	return b.Delete(storeKey(relative))
+}
+
+func (s *boltNoteStore) Children(relative string) ([]string, error) {
+	var res []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		res = listChildren(tx.Bucket(boltNoteBucket), relative)
+		return nil
+	})
+	return res, err
+}
+
+func listChildren(b *bolt.Bucket, relative string) []string {
+	var res []string
+	prefix := childPrefix(relative)
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+		res = append(res, string(k[len(prefix):]))
+	}
+	return res
+}
+
+func (s *boltNoteStore) Iterate(fn func(relative string, node *NoteTreeNode) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltNoteBucket)
+		if b.Get(storeKey("/")) == nil {
+			return nil
+		}
+		return iterateFrom(b, "", fn)
+	})
+}
+
+func iterateFrom(b *bolt.Bucket, relative string, fn func(string, *NoteTreeNode) error) error {
+	node := &NoteTreeNode{}
+	err := json.Unmarshal(b.Get(storeKey(relative)), node)
+	if err != nil {
+		return err
+	}
+	node.Links = make(map[string]*NoteTreeNode)
+	err = fn("/"+relative, node)
+	if err != nil {
+		return err
+	}
+	for _, name := range listChildren(b, relative) {
+		err = iterateFrom(b, path.Join(relative, name), fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *boltNoteStore) Update(fn func(w NoteStoreWriter) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(&boltNoteWriter{b: tx.Bucket(boltNoteBucket)})
+	})
+}
+
+// boltNoteWriter write entries in a transaction of bbolt.
+type boltNoteWriter struct {
+	b *bolt.Bucket
+}
+
+func (w *boltNoteWriter) Put(relative string, node *NoteTreeNode) error {
+	data, err := json.Marshal(node.LightCopy())
+	if err != nil {
+		return err
+	}
+	return w.b.Put(storeKey(relative), data)
+}
+
+func (w *boltNoteWriter) Delete(relative string) error {
+	return deleteRecursively(w.b, cleanRelative(relative))
+}
+
+func (w *boltNoteWriter) Children(relative string) ([]string, error) {
+	return listChildren(w.b, relative), nil
+}
 
-}
\ No newline at end of file
+func (s *boltNoteStore) Close() error {
+	return s.db.Close()
+}
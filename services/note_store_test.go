@@ -0,0 +1,288 @@
+package services
+
+import (
+	"go-blog/common"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStoreKey(t *testing.T) {
+	tests := []struct {
+		relative string
+		want     string
+	}{
+		{"/", "/"},
+		{"", "/"},
+		{"/a.md", "\x00a.md"},
+		{"a.md", "\x00a.md"},
+		{"/dir/b.md", "dir\x00b.md"},
+		{"/dir/sub/", "dir\x00sub"},
+		{"/dir/./sub/../c.md", "dir\x00c.md"},
+	}
+	for _, tt := range tests {
+		if got := string(storeKey(tt.relative)); got != tt.want {
+			t.Errorf("storeKey(%q) = %q, want %q", tt.relative, got, tt.want)
+		}
+	}
+}
+
+// openTestStore open a bolt note store in a temporary directory, which is closed after test.
+func openTestStore(t *testing.T, filePath string) NoteStore {
+	store, err := OpenBoltNoteStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func storedPaths(t *testing.T, store NoteStore) []string {
+	var res []string
+	err := store.Iterate(func(relative string, node *NoteTreeNode) error {
+		res = append(res, relative)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestBoltNoteStore(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "notes.db")
+	store := openTestStore(t, filePath)
+	if paths := storedPaths(t, store); paths != nil {
+		t.Errorf("Iterate() of empty store = %q, want nothing", paths)
+	}
+	for _, relative := range []string{"/", "/a.md", "/dir", "/dir/b.md", "/dir/sub", "/dir/sub/c.md", "/dirx", "/dirx/d.md"} {
+		node := &NoteTreeNode{Name: filepath.Base(relative), IsDir: filepath.Ext(relative) != ".md", Hash: "h" + relative}
+		if err := store.Put(relative, node); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node, err := store.Get("/dir/sub/c.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Name != "c.md" || node.Hash != "h/dir/sub/c.md" || node.Links == nil {
+		t.Errorf("Get() = %+v, want c.md with its hash and empty links", node)
+	}
+	if _, err := store.Get("/missing.md"); !isNoSuchNode(err) {
+		t.Errorf("Get() of missing entry error = %v, want *common.ErrNoSuchNode", err)
+	}
+
+	childrenTests := []struct {
+		relative string
+		want     []string
+	}{
+		{"/", []string{"a.md", "dir", "dirx"}},
+		{"/dir", []string{"b.md", "sub"}},
+		{"/dir/sub", []string{"c.md"}},
+		{"/a.md", nil},
+	}
+	for _, tt := range childrenTests {
+		got, err := store.Children(tt.relative)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Children(%q) = %q, %v, want %q", tt.relative, got, err, tt.want)
+		}
+	}
+
+	want := []string{"/", "/a.md", "/dir", "/dir/b.md", "/dir/sub", "/dir/sub/c.md", "/dirx", "/dirx/d.md"}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("Iterate() = %q, want %q", got, want)
+	}
+
+	// Deleting a directory deletes its descendants, but not siblings sharing its prefix.
+	if err := store.Delete("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"/", "/a.md", "/dirx", "/dirx/d.md"}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("Iterate() after Delete() = %q, want %q", got, want)
+	}
+	if _, err := store.Get("/dir/sub/c.md"); !isNoSuchNode(err) {
+		t.Errorf("Get() of deleted descendant error = %v, want *common.ErrNoSuchNode", err)
+	}
+
+	// Entries are kept after the store is opened again.
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store = openTestStore(t, filePath)
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("Iterate() after reopen = %q, want %q", got, want)
+	}
+}
+
+func isNoSuchNode(err error) bool {
+	_, ok := err.(*common.ErrNoSuchNode)
+	return ok
+}
+
+func TestNoteServiceWithStore(t *testing.T) {
+	root, cache := t.TempDir(), t.TempDir()
+	writeNotes(t, root, map[string]string{
+		"a.md":         "# A\n",
+		"dir/b.md":     "# B\n",
+		"dir/sub/c.md": "# C\n",
+	})
+	storePath := filepath.Join(t.TempDir(), "notes.db")
+	store := openTestStore(t, storePath)
+	ns := NewFsNoteServiceWithStore(cache, root, store).(*fsNoteService)
+	setSearchIndex(ns, newSearchIndex(filepath.Join(t.TempDir(), "search.idx")))
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/", "/a.md", "/dir", "/dir/b.md", "/dir/sub", "/dir/sub/c.md"}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stored = %q, want %q", got, want)
+	}
+
+	// Only the root is read on load, children are read on first access.
+	reloaded := NewFsNoteServiceWithStore(cache, root, store).(*fsNoteService)
+	setSearchIndex(reloaded, ns.search)
+	if err := reloaded.readIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.root.Links) != 0 {
+		t.Errorf("children of root are loaded before accessed: %v", reloaded.root.Links)
+	}
+	c := reloaded.Fetch("/dir/sub/c.md", false)
+	if c == nil || c.Hash != ns.Fetch("/dir/sub/c.md", false).Hash || c.parent.parent.Name != "dir" {
+		t.Fatalf("Fetch() from store = %+v, want c.md linked under dir", c)
+	}
+
+	// Notes removed from disk are deleted from store with their descendants.
+	if err := os.RemoveAll(filepath.Join(root, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	markRendered(t, cache, "a.html")
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if isRenderedAgain(t, cache, "a.html") {
+		t.Error("a.md is rendered again though it is restored from store")
+	}
+	if err := reloaded.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"/", "/a.md"}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored after removal = %q, want %q", got, want)
+	}
+}
+
+func TestBoltNoteStoreUpdate(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "notes.db"))
+	put := func(w NoteStoreWriter, relatives ...string) error {
+		for _, relative := range relatives {
+			if err := w.Put(relative, &NoteTreeNode{Name: filepath.Base(relative)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := store.Update(func(w NoteStoreWriter) error {
+		if err := put(w, "/", "/dir", "/dir/a.md", "/dir/b.md"); err != nil {
+			return err
+		}
+		// Changes not committed yet are seen by the writer.
+		if names, err := w.Children("/dir"); err != nil || !reflect.DeepEqual(names, []string{"a.md", "b.md"}) {
+			t.Errorf("Children() in Update() = %q, %v, want both notes", names, err)
+		}
+		return w.Delete("/dir/b.md")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/", "/dir", "/dir/a.md"}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored after Update() = %q, want %q", got, want)
+	}
+
+	// Nothing is changed if fn fails.
+	err = store.Update(func(w NoteStoreWriter) error {
+		if err := put(w, "/c.md"); err != nil {
+			return err
+		}
+		if err := w.Delete("/dir"); err != nil {
+			return err
+		}
+		return os.ErrInvalid
+	})
+	if err != os.ErrInvalid {
+		t.Errorf("Update() error = %v, want error of fn", err)
+	}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored after failed Update() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteStoreLoaded(t *testing.T) {
+	root, cache := t.TempDir(), t.TempDir()
+	writeNotes(t, root, map[string]string{
+		"a.md":         "# A\n",
+		"dir/b.md":     "# B\n",
+		"dir/sub/c.md": "# C\n",
+	})
+	store := openTestStore(t, filepath.Join(t.TempDir(), "notes.db"))
+	ns := NewFsNoteServiceWithStore(cache, root, store).(*fsNoteService)
+	setSearchIndex(ns, newSearchIndex(filepath.Join(t.TempDir(), "search.idx")))
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewFsNoteServiceWithStore(cache, root, store).(*fsNoteService)
+	setSearchIndex(reloaded, ns.search)
+	if err := reloaded.readIndex(); err != nil {
+		t.Fatal(err)
+	}
+	a := reloaded.Fetch("/a.md", false)
+	if a == nil {
+		t.Fatal("Fetch() of a.md from store = nil")
+	}
+	dir := reloaded.root.Links["dir"]
+	if dir == nil || dir.childrenLoaded() {
+		t.Fatalf("dir = %+v, want it linked with children not loaded", dir)
+	}
+
+	// Entries of nodes not changed are not written again.
+	if err := store.Put("/a.md", &NoteTreeNode{Name: "a.md", Hash: "stale"}); err != nil {
+		t.Fatal(err)
+	}
+	// Subtrees not loaded are neither loaded nor deleted.
+	if err := reloaded.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	if dir.childrenLoaded() {
+		t.Error("children of dir are loaded by WriteBack()")
+	}
+	want := []string{"/", "/a.md", "/dir", "/dir/b.md", "/dir/sub", "/dir/sub/c.md"}
+	if got := storedPaths(t, store); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored = %q, want %q", got, want)
+	}
+	if got, err := store.Get("/a.md"); err != nil || got.Hash != "stale" {
+		t.Errorf("a.md in store = %+v, %v, want it not written again", got, err)
+	}
+
+	// Nodes changed are written.
+	reloaded.lock.Lock()
+	a.Hash = "changed"
+	reloaded.lock.Unlock()
+	if err := reloaded.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("/a.md"); err != nil || got.Hash != "changed" {
+		t.Errorf("a.md in store = %+v, %v, want it written", got, err)
+	}
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"go-blog/common"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWatchDelay is the time of quiet a watcher waits before applying changes,
+// so that a burst of events from a single save would only cause one refresh.
+const DefaultWatchDelay = 500 * time.Millisecond
+
+// DefaultPollInterval is the interval of scanning when fsnotify is not available.
+// It should be longer than DefaultWatchDelay.
+const DefaultPollInterval = 2 * time.Second
+
+// watchOption is used to refresh directories containing changed files.
+// Sub directories are only scanned if they are new.
+var watchOption = &RefreshOption{
+	Recursive:  false,
+	Render:     true,
+	OverWrite:  false,
+	CopyOthers: true,
+}
+
+// noteWatcher watch the notes root of a note service and keep the tree
+// and rendered cache up to date.
+// It is based on fsnotify and would fall back to polling if fsnotify is not available.
+type noteWatcher struct {
+	ns       *fsNoteService
+	fsw      *fsnotify.Watcher // nil if polling.
+	watched  map[string]bool   // Directories added to fsw.
+	snapshot map[string]fileStamp
+
+	delay    time.Duration
+	interval time.Duration
+	changed  map[string]bool // Changed paths waiting for the delay.
+	closeCh  chan struct{}
+	wg       sync.WaitGroup
+}
+
+// fileStamp is what polling compares to find changed files.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	isDir   bool
+}
+
+func newNoteWatcher(ns *fsNoteService) *noteWatcher {
+	w := &noteWatcher{
+		ns:       ns,
+		watched:  make(map[string]bool),
+		delay:    DefaultWatchDelay,
+		interval: DefaultPollInterval,
+		changed:  make(map[string]bool),
+		closeCh:  make(chan struct{}),
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warn("Can not create fsnotify watcher, fall back to polling: ", err)
+		return w
+	}
+	w.fsw = fsw
+	err = w.syncWatches()
+	if err != nil {
+		log.Warn("Can not watch notes root with fsnotify, fall back to polling: ", err)
+		fsw.Close()
+		w.fsw = nil
+		w.watched = make(map[string]bool)
+	}
+	return w
+}
+
+func (w *noteWatcher) start() {
+	w.wg.Add(1)
+	if w.fsw != nil {
+		go w.runNotify()
+	} else {
+		w.snapshot = w.takeSnapshot()
+		go w.runPoll()
+	}
+}
+
+func (w *noteWatcher) stop() {
+	close(w.closeCh)
+	w.wg.Wait()
+	if w.fsw != nil {
+		w.fsw.Close()
+	}
+}
+
+func (w *noteWatcher) runNotify() {
+	defer w.wg.Done()
+	timer := time.NewTimer(w.delay)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.changed[event.Name] = true
+			timer.Reset(w.delay)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Error("Error from fsnotify watcher: ", err)
+		case <-timer.C:
+			w.flush()
+			err := w.syncWatches()
+			if err != nil {
+				log.Error("Error when watch new directories: ", err)
+			}
+		case <-w.closeCh:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (w *noteWatcher) runPoll() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			current := w.takeSnapshot()
+			found := false
+			for p, stamp := range current {
+				if old, ok := w.snapshot[p]; !ok || old != stamp {
+					w.changed[p] = true
+					found = true
+				}
+			}
+			for p := range w.snapshot {
+				if _, ok := current[p]; !ok {
+					w.changed[p] = true
+					found = true
+				}
+			}
+			w.snapshot = current
+			// Changes are applied on the first tick without new changes, which works as the delay.
+			if !found && len(w.changed) > 0 {
+				w.flush()
+			}
+		case <-w.closeCh:
+			return
+		}
+	}
+}
+
+// takeSnapshot collect the stamps of all visible files under notes root.
+func (w *noteWatcher) takeSnapshot() map[string]fileStamp {
+	res := make(map[string]fileStamp)
+	root := w.ns.rootRawPath()
+	_ = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if p != root && strings.HasPrefix(info.Name(), ".") && info.Name() != DirSettingsFile {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		res[p] = fileStamp{modTime: info.ModTime(), size: info.Size(), isDir: info.IsDir()}
+		return nil
+	})
+	return res
+}
+
+// syncWatches add fsnotify watches for directories in tree that are not watched yet.
+// Watches of directories no longer in tree are removed.
+func (w *noteWatcher) syncWatches() error {
+	var dirs []string
+	w.ns.lock.RLock()
+	_ = w.ns.root.walk(func(node *NoteTreeNode) error {
+		if node.IsDir {
+			dirs = append(dirs, node.RawPath)
+		}
+		return nil
+	})
+	w.ns.lock.RUnlock()
+
+	current := make(map[string]bool)
+	for _, dir := range dirs {
+		current[dir] = true
+	}
+	// Remove stale watches first since a renamed directory keeps its inotify watch,
+	// which would be shared with the watch added for its new path.
+	for dir := range w.watched {
+		if !current[dir] {
+			_ = w.fsw.Remove(dir)
+			delete(w.watched, dir)
+		}
+	}
+	for _, dir := range dirs {
+		if w.watched[dir] {
+			continue
+		}
+		err := w.fsw.Add(dir)
+		if err != nil {
+			return err
+		}
+		w.watched[dir] = true
+	}
+	return nil
+}
+
+// flush refresh the directories containing changed paths.
+// New directories are scanned recursively.
+func (w *noteWatcher) flush() {
+	changed := w.changed
+	w.changed = make(map[string]bool)
+
+	root := w.ns.rootRawPath()
+	parents := make(map[string]bool)
+	var newDirs []string
+	for p := range changed {
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = "/" + filepath.ToSlash(rel)
+		if path.Base(rel) == DirSettingsFile {
+			// Settings of directory changed, which are read again when it is refreshed.
+			if dir := path.Dir(rel); !strings.Contains(dir, "/.") {
+				parents[dir] = true
+			}
+			continue
+		}
+		if strings.Contains(rel, "/.") {
+			continue
+		}
+		parents[path.Dir(rel)] = true
+		if common.DirectoryExist(p) {
+			newDirs = append(newDirs, rel)
+		}
+	}
+
+	// Refresh parents before children so that new directories are linked before being scanned.
+	dirs := make([]string, 0, len(parents))
+	for dir := range parents {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") < strings.Count(dirs[j], "/")
+	})
+	for _, dir := range dirs {
+		w.refresh(dir, watchOption)
+	}
+	recursive := *watchOption
+	recursive.Recursive = true
+	for _, dir := range newDirs {
+		w.refresh(dir, &recursive)
+	}
+
+	// Keep indexes on disk fresh, so that they can be read by commands while server is running.
+	_ = w.ns.WriteBack()
+}
+
+func (w *noteWatcher) refresh(relative string, option *RefreshOption) {
+	err := w.ns.Refresh(relative, option)
+	if err == nil {
+		return
+	}
+	if _, ok := err.(*common.ErrNoSuchNode); ok {
+		// Parent is gone or not a note directory, nothing to do.
+		return
+	}
+	log.Error("Error when refresh ", relative, " for changes: ", err)
+}
+
+func (ns *fsNoteService) Watch() error {
+	ns.watchLock.Lock()
+	defer ns.watchLock.Unlock()
+	if ns.watcher != nil {
+		return nil
+	}
+	root := ns.rootRawPath()
+	if !common.DirectoryExist(root) {
+		return &common.ErrDirectoryNotExists{Path: root}
+	}
+	ns.watcher = newNoteWatcher(ns)
+	ns.watcher.start()
+	return nil
+}
+
+func (ns *fsNoteService) StopWatch() {
+	ns.watchLock.Lock()
+	defer ns.watchLock.Unlock()
+	if ns.watcher == nil {
+		return
+	}
+	ns.watcher.stop()
+	ns.watcher = nil
+}
+
+func (ns *fsNoteService) rootRawPath() string {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	return ns.root.RawPath
+}
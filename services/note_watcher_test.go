@@ -0,0 +1,91 @@
+package services
+
+import (
+	"go-blog/common"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitFor poll cond until it is true, and fail the test if it is not true in time.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout when wait for ", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestNoteWatcher(t *testing.T) {
+	tests := []struct {
+		name string
+		poll bool // Whether to fall back to polling.
+	}{
+		{"fsnotify", false},
+		{"polling", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, root, cache := newTestNotes(t, map[string]string{"dir/a.md": "# A\n"})
+			if err := ns.LoadFromDisk(); err != nil {
+				t.Fatal(err)
+			}
+			w := newNoteWatcher(ns)
+			if tt.poll && w.fsw != nil {
+				_ = w.fsw.Close()
+				w.fsw = nil
+			}
+			if !tt.poll && w.fsw == nil {
+				t.Skip("fsnotify is not available")
+			}
+			w.delay = 50 * time.Millisecond
+			w.interval = 100 * time.Millisecond
+			w.start()
+			defer w.stop()
+			exists := func(relative string) func() bool {
+				return func() bool { return ns.Fetch(relative, false) != nil }
+			}
+			rendered := func(name string) bool {
+				return common.FileExist(filepath.Join(cache, filepath.FromSlash(name)))
+			}
+
+			writeNotes(t, root, map[string]string{"dir/b.md": "# B\n", "new/c.md": "# C\n"})
+			waitFor(t, "created notes", func() bool {
+				return exists("/dir/b.md")() && exists("/new/c.md")()
+			})
+			if !rendered("dir/b.html") || !rendered("new/c.html") {
+				t.Error("created notes are not rendered")
+			}
+
+			err := os.Rename(filepath.Join(root, "dir", "b.md"), filepath.Join(root, "dir", "renamed.md"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "renamed note", func() bool {
+				return exists("/dir/renamed.md")() && !exists("/dir/b.md")()
+			})
+			if !rendered("dir/renamed.html") || rendered("dir/b.html") {
+				t.Error("rendered file of renamed note is not moved")
+			}
+
+			if err := os.Remove(filepath.Join(root, "dir", "a.md")); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "deleted note", func() bool { return !exists("/dir/a.md")() })
+			if rendered("dir/a.html") {
+				t.Error("rendered file of deleted note is kept")
+			}
+		})
+	}
+}
+
+func TestWatchMissingRoot(t *testing.T) {
+	ns := NewFsNoteService(t.TempDir(), filepath.Join(t.TempDir(), "missing")).(*fsNoteService)
+	if _, ok := ns.Watch().(*common.ErrDirectoryNotExists); !ok {
+		t.Error("Watch() of missing notes root does not return *common.ErrDirectoryNotExists")
+	}
+	ns.StopWatch()
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"encoding/gob"
+	"go-blog/common"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Parameters of BM25.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// titleWeight is how many times terms in title are counted.
+const titleWeight = 3
+
+// snippetLength is the number of characters around the first match in a snippet.
+const snippetLength = 120
+
+// SearchResult is a note matching a query.
+type SearchResult struct {
+	Path    string
+	Title   string
+	Score   float64
+	Snippet string   // Plain text around the first match.
+	Matches [][2]int // Byte ranges of query terms in Snippet.
+}
+
+// searchDoc is a note in search index.
+type searchDoc struct {
+	Title  string
+	Hash   string // Hash of the note when indexed, to skip notes not changed.
+	Text   string // Plain text of the note, used to build snippets.
+	Length int    // Number of terms.
+	Terms  map[string]int
+}
+
+// SearchIndex is an inverted index of notes stored in a single file.
+// It listens to note service so that it is updated incrementally when notes change.
+// Text is split into lower case words, while Chinese, Japanese and Korean
+// text is split into overlapping bigrams since there is no space between words.
+type SearchIndex struct {
+	Docs     map[string]*searchDoc
+	Postings map[string]map[string]int // Term -> relative path -> term frequency.
+	TotalLen int
+
+	path  string
+	dirty bool
+	lock  sync.RWMutex
+}
+
+// OpenSearchIndex read the index from filePath.
+// An empty index would be returned if the file does not exist.
+func OpenSearchIndex(filePath string) (*SearchIndex, error) {
+	idx := newSearchIndex(filePath)
+	if !common.FileExist(filePath) {
+		return idx, nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = gob.NewDecoder(f).Decode(idx)
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// newSearchIndex create an empty index which would be saved to filePath.
+func newSearchIndex(filePath string) *SearchIndex {
+	return &SearchIndex{
+		Docs:     make(map[string]*searchDoc),
+		Postings: make(map[string]map[string]int),
+		path:     filePath,
+	}
+}
+
+// Save write the index back to its file if it changed since opened.
+func (idx *SearchIndex) Save() error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if !idx.dirty {
+		return nil
+	}
+	tmpPath := idx.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0664)
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(idx)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, idx.path)
+	if err == nil {
+		idx.dirty = false
+	}
+	return err
+}
+
+func (idx *SearchIndex) NoteUpdated(relative string, node *NoteTreeNode) {
+	idx.lock.RLock()
+	doc, ok := idx.Docs[relative]
+	idx.lock.RUnlock()
+	if ok && node.Hash != "" && doc.Hash == node.Hash {
+		return
+	}
+
+	data, err := ioutil.ReadFile(node.RawPath)
+	if err != nil {
+		log.Error("Error when read note for search index: ", err)
+		return
+	}
+	_, body, err := common.SplitFrontMatter(data)
+	if err != nil {
+		log.Error("Error when read note for search index: ", err)
+		return
+	}
+	title := node.Title()
+	doc = &searchDoc{
+		Title: title,
+		Hash:  node.Hash,
+		Text:  common.MdPlainTextOf(body),
+		Terms: make(map[string]int),
+	}
+	for _, term := range Tokenize(title) {
+		doc.Terms[term] += titleWeight
+		doc.Length += titleWeight
+	}
+	for _, term := range Tokenize(doc.Text) {
+		doc.Terms[term]++
+		doc.Length++
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.remove(relative)
+	idx.Docs[relative] = doc
+	idx.TotalLen += doc.Length
+	for term, tf := range doc.Terms {
+		if idx.Postings[term] == nil {
+			idx.Postings[term] = make(map[string]int)
+		}
+		idx.Postings[term][relative] = tf
+	}
+	idx.dirty = true
+}
+
+func (idx *SearchIndex) NoteRemoved(relative string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	idx.remove(relative)
+}
+
+// Retain drop notes not in paths, which may be removed while nobody is listening.
+func (idx *SearchIndex) Retain(paths map[string]bool) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	for relative := range idx.Docs {
+		if !paths[relative] {
+			idx.remove(relative)
+		}
+	}
+}
+
+// remove should be called with lock held.
+func (idx *SearchIndex) remove(relative string) {
+	doc, ok := idx.Docs[relative]
+	if !ok {
+		return
+	}
+	for term := range doc.Terms {
+		delete(idx.Postings[term], relative)
+		if len(idx.Postings[term]) == 0 {
+			delete(idx.Postings, term)
+		}
+	}
+	idx.TotalLen -= doc.Length
+	delete(idx.Docs, relative)
+	idx.dirty = true
+}
+
+// Search return at most limit notes matching any term of query, ranked by BM25.
+func (idx *SearchIndex) Search(query string, limit int) []SearchResult {
+	return idx.SearchFiltered(query, limit, nil)
+}
+
+// SearchFiltered is like Search but only return notes whose relative paths are accepted by filter.
+// All notes are accepted if filter is nil.
+func (idx *SearchIndex) SearchFiltered(query string, limit int, filter func(relative string) bool) []SearchResult {
+	terms := uniqueTerms(Tokenize(query))
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	if len(terms) == 0 || len(idx.Docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(idx.Docs))
+	avgLen := float64(idx.TotalLen) / n
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		postings := idx.Postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for relative, tf := range postings {
+			docLen := float64(idx.Docs[relative].Length)
+			f := float64(tf)
+			scores[relative] += idf * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*docLen/avgLen))
+		}
+	}
+
+	res := make([]SearchResult, 0, len(scores))
+	for relative, score := range scores {
+		if filter == nil || filter(relative) {
+			res = append(res, SearchResult{Path: relative, Score: score})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Path < res[j].Path
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	for i := range res {
+		doc := idx.Docs[res[i].Path]
+		res[i].Title = doc.Title
+		res[i].Snippet, res[i].Matches = snippet(doc.Text, terms)
+	}
+	return res
+}
+
+// Tokenize split text into lower case terms.
+// Runs of letters and digits are words, runs of CJK characters are split into
+// overlapping bigrams, a single CJK character is a term itself.
+func Tokenize(text string) []string {
+	var res []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) > 0 {
+			res = append(res, string(word))
+			word = word[:0]
+		}
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			res = append(res, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			res = append(res, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range text {
+		switch {
+		case isIdeograph(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushCJK()
+			word = append(word, unicode.ToLower(r))
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return res
+}
+
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			res = append(res, term)
+		}
+	}
+	return res
+}
+
+// snippet cut text around the first occurrence of terms
+// and return the byte ranges of all terms in it.
+func snippet(text string, terms []string) (string, [][2]int) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	first := -1
+	for _, term := range terms {
+		if i := indexRunes(lower, []rune(term), 0); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	start := 0
+	if first > snippetLength/3 {
+		start = first - snippetLength/3
+	}
+	end := start + snippetLength
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	// Mark every rune covered by a term, then merge them into ranges.
+	marked := make([]bool, end-start)
+	for _, term := range terms {
+		t := []rune(term)
+		for i := indexRunes(lower[:end], t, start); i >= 0; i = indexRunes(lower[:end], t, i+1) {
+			for j := i; j < i+len(t); j++ {
+				marked[j-start] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	var matches [][2]int
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i, r := range runes[start:end] {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			matches = append(matches, [2]int{b.Len(), 0})
+		}
+		b.WriteRune(r)
+		if marked[i] {
+			matches[len(matches)-1][1] = b.Len()
+		}
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), matches
+}
+
+// indexRunes return the index of the first sub in s starting from from, or -1.
+func indexRunes(s []rune, sub []rune, from int) int {
+	for i := from; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
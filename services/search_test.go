@@ -0,0 +1,180 @@
+package services
+
+import (
+	"go-blog/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"words", "Hello, World!", []string{"hello", "world"}},
+		{"digits", "go 1.16", []string{"go", "1", "16"}},
+		{"cjk bigrams", "全文搜索", []string{"全文", "文搜", "搜索"}},
+		{"single cjk", "字", []string{"字"}},
+		{"mixed", "用Go写博客", []string{"用", "go", "写博", "博客"}},
+		{"cjk punctuation", "笔记，搜索", []string{"笔记", "搜索"}},
+		{"kana", "ひらがな", []string{"ひら", "らが", "がな"}},
+		{"empty", " \t\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestSearchIndex index notes with names and contents in a temporary directory.
+func newTestSearchIndex(t *testing.T, notes map[string]string) *SearchIndex {
+	dir := t.TempDir()
+	idx := newSearchIndex(filepath.Join(dir, "search.idx"))
+	for name, content := range notes {
+		rawPath := filepath.Join(dir, name)
+		err := ioutil.WriteFile(rawPath, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx.NoteUpdated("/"+name, &NoteTreeNode{Name: name, RawPath: rawPath})
+	}
+	return idx
+}
+
+func TestSearchRanking(t *testing.T) {
+	idx := newTestSearchIndex(t, map[string]string{
+		"golang.md":  "Go is a language. Go programs are fast, go go go.",
+		"python.md":  "Python is a language. It is not go, but it is fine.",
+		"cooking.md": "Cooking pasta takes ten minutes.",
+		"pasta.md":   "Pasta is cooked in ten minutes.",
+		"搜索.md":      "全文搜索把笔记切成二元组。",
+	})
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{"frequent first", "go", 0, []string{"/golang.md", "/python.md"}},
+		{"title first", "pasta", 0, []string{"/pasta.md", "/cooking.md"}},
+		{"rare term first", "language fast", 0, []string{"/golang.md", "/python.md"}},
+		{"any term and shorter first", "cooking python", 0, []string{"/cooking.md", "/python.md"}},
+		{"limit", "ten", 1, []string{"/cooking.md"}},
+		{"cjk", "搜索", 0, []string{"/搜索.md"}},
+		{"no match", "rust", 0, nil},
+		{"no term", "!!", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, res := range idx.Search(tt.query, tt.limit) {
+				got = append(got, res.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilteredAndRemoved(t *testing.T) {
+	idx := newTestSearchIndex(t, map[string]string{
+		"a.md": "shared term",
+		"b.md": "shared term",
+	})
+	res := idx.SearchFiltered("shared", 0, func(relative string) bool {
+		return relative != "/a.md"
+	})
+	if len(res) != 1 || res[0].Path != "/b.md" {
+		t.Errorf("SearchFiltered() = %v, want only /b.md", res)
+	}
+
+	idx.NoteRemoved("/b.md")
+	res = idx.Search("shared", 0)
+	if len(res) != 1 || res[0].Path != "/a.md" {
+		t.Errorf("Search() after remove = %v, want only /a.md", res)
+	}
+	if _, ok := idx.Postings["shared"]["/b.md"]; ok {
+		t.Error("postings of removed note are kept")
+	}
+}
+
+// setSearchIndex replace the search index of ns with idx,
+// so that tests would not touch the index in config directory.
+func setSearchIndex(ns *fsNoteService, idx *SearchIndex) {
+	for i, l := range ns.listeners {
+		if l == NoteListener(ns.search) {
+			ns.listeners[i] = idx
+		}
+	}
+	ns.search = idx
+}
+
+func searchPaths(results []SearchResult) []string {
+	var res []string
+	for _, r := range results {
+		res = append(res, r.Path)
+	}
+	return res
+}
+
+func TestNoteServiceSearch(t *testing.T) {
+	ns, root, _ := newTestNotes(t, map[string]string{
+		"a.md":     "# Go\n\nGo is a fast language.\n",
+		"dir/b.md": "# Pasta\n\nCooking pasta takes ten minutes.\n",
+		"dir/c.md": "# Rice\n\nCooking rice takes twenty minutes.\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/dir/b.md", "/dir/c.md"}
+	if got := searchPaths(ns.Search("cooking", 0, "")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+	res := ns.Search("pasta", 1, "")
+	if len(res) != 1 || res[0].Title != "b" || res[0].Snippet == "" {
+		t.Errorf("Search() = %+v, want b.md with its title and a snippet", res)
+	}
+
+	// Notes removed through service are dropped from index.
+	if err := ns.Remove("/dir/c.md"); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchPaths(ns.Search("cooking", 0, "")); !reflect.DeepEqual(got, []string{"/dir/b.md"}) {
+		t.Errorf("Search() after Remove() = %q, want only /dir/b.md", got)
+	}
+
+	// Index is saved by WriteBack and searchable before notes are loaded again.
+	if err := ns.WriteBack(); err != nil {
+		t.Fatal(err)
+	}
+	if !common.FileExist(ns.search.path) {
+		t.Fatal("search index is not saved")
+	}
+	reloaded := reopen(ns)
+	// Notes are only searchable through service after they are loaded and their visibility is known.
+	if got := searchPaths(reloaded.search.Search("language", 0)); !reflect.DeepEqual(got, []string{"/a.md"}) {
+		t.Errorf("Search() of saved index = %q, want only /a.md", got)
+	}
+
+	// Notes removed from disk while not watched are dropped on load.
+	if err := os.Remove(filepath.Join(root, "a.md")); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloaded.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.Search("language", 0, ""); len(got) != 0 {
+		t.Errorf("Search() after note is removed from disk = %v, want nothing", got)
+	}
+	if got := searchPaths(reloaded.Search("pasta", 0, "")); !reflect.DeepEqual(got, []string{"/dir/b.md"}) {
+		t.Errorf("Search() after reload = %q, want only /dir/b.md", got)
+	}
+}
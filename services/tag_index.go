@@ -0,0 +1,177 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TagCount is a tag or category with the number of notes in it.
+type TagCount struct {
+	Name  string
+	Count int
+}
+
+// NoteRef is a note found by an index, with its relative path in tree.
+type NoteRef struct {
+	Path string
+	Note *NoteTreeNode // Light copy of the note.
+}
+
+// tagIndex group notes by tags and categories in their front matter.
+// Tags are matched case-insensitively, the spelling first seen is kept for display.
+type tagIndex struct {
+	tags       *groupIndex
+	categories *groupIndex
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		tags:       newGroupIndex(),
+		categories: newGroupIndex(),
+	}
+}
+
+func (t *tagIndex) NoteUpdated(relative string, node *NoteTreeNode) {
+	var tags, categories []string
+	if node.Meta != nil {
+		tags = node.Meta.Tags
+		categories = node.Meta.Categories
+	}
+	t.tags.set(relative, tags)
+	t.categories.set(relative, categories)
+}
+
+func (t *tagIndex) NoteRemoved(relative string) {
+	t.tags.set(relative, nil)
+	t.categories.set(relative, nil)
+}
+
+// groupIndex map group names to the notes in them.
+type groupIndex struct {
+	groups  map[string]map[string]bool // Key of group -> set of relative paths.
+	names   map[string]string          // Key of group -> name for display.
+	ofNotes map[string][]string        // Relative path -> keys of groups.
+	lock    sync.RWMutex
+}
+
+func newGroupIndex() *groupIndex {
+	return &groupIndex{
+		groups:  make(map[string]map[string]bool),
+		names:   make(map[string]string),
+		ofNotes: make(map[string][]string),
+	}
+}
+
+func groupKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// set replace the groups of note relative with names.
+func (g *groupIndex) set(relative string, names []string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, key := range g.ofNotes[relative] {
+		delete(g.groups[key], relative)
+		if len(g.groups[key]) == 0 {
+			delete(g.groups, key)
+			delete(g.names, key)
+		}
+	}
+	delete(g.ofNotes, relative)
+
+	for _, name := range names {
+		key := groupKey(name)
+		if key == "" || g.groups[key][relative] {
+			continue
+		}
+		if _, ok := g.groups[key]; !ok {
+			g.groups[key] = make(map[string]bool)
+			g.names[key] = strings.TrimSpace(name)
+		}
+		g.groups[key][relative] = true
+		g.ofNotes[relative] = append(g.ofNotes[relative], key)
+	}
+}
+
+// counts return groups sorted by count then name. Only notes accepted by filter are counted.
+func (g *groupIndex) counts(filter func(relative string) bool) []TagCount {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	res := make([]TagCount, 0, len(g.groups))
+	for key, notes := range g.groups {
+		count := 0
+		for relative := range notes {
+			if filter(relative) {
+				count++
+			}
+		}
+		if count > 0 {
+			res = append(res, TagCount{Name: g.names[key], Count: count})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// notes return relative paths of notes in group name.
+func (g *groupIndex) notes(name string) []string {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	var res []string
+	for relative := range g.groups[groupKey(name)] {
+		res = append(res, relative)
+	}
+	return res
+}
+
+func (ns *fsNoteService) Tags(role string) []TagCount {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	return ns.tags.tags.counts(ns.listedFilter(role))
+}
+
+func (ns *fsNoteService) Categories(role string) []TagCount {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	return ns.tags.categories.counts(ns.listedFilter(role))
+}
+
+func (ns *fsNoteService) NotesOfTag(tag string, role string) []NoteRef {
+	return ns.refs(ns.tags.tags.notes(tag), role)
+}
+
+func (ns *fsNoteService) NotesOfCategory(category string, role string) []NoteRef {
+	return ns.refs(ns.tags.categories.notes(category), role)
+}
+
+// refs fetch light copies of notes with relative paths listed for role,
+// sorted by date in front matter from newest to oldest.
+func (ns *fsNoteService) refs(paths []string, role string) []NoteRef {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	res := make([]NoteRef, 0, len(paths))
+	for _, relative := range paths {
+		node := ns.root.walkTo(strings.Split(relative, "/"), 0)
+		if node != nil && IsListed(node.effectiveVisibility(), role) {
+			res = append(res, NoteRef{Path: relative, Note: node.LightCopy()})
+		}
+	}
+	sortRefs(res)
+	return res
+}
+
+func sortRefs(refs []NoteRef) {
+	sort.Slice(refs, func(i, j int) bool {
+		ti, tj := refs[i].Note.Date(), refs[j].Note.Date()
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return refs[i].Path < refs[j].Path
+	})
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func refPaths(refs []NoteRef) []string {
+	var res []string
+	for _, ref := range refs {
+		res = append(res, ref.Path)
+	}
+	return res
+}
+
+func TestTagIndex(t *testing.T) {
+	ns, _, _ := newTestNotes(t, map[string]string{
+		"a.md":     "---\ntags: [Go, web]\ncategories: [dev]\ndate: 2021-01-01\n---\n# A\n",
+		"dir/b.md": "---\ntags: [go]\ncategories: [dev]\ndate: 2021-02-01\n---\n# B\n",
+		"c.md":     "# C\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantTags := []TagCount{{"Go", 2}, {"web", 1}}
+	if got := ns.Tags(""); !reflect.DeepEqual(got, wantTags) {
+		t.Errorf("Tags() = %v, want %v", got, wantTags)
+	}
+	if got := ns.Categories(""); !reflect.DeepEqual(got, []TagCount{{"dev", 2}}) {
+		t.Errorf("Categories() = %v, want dev of 2 notes", got)
+	}
+	// Newest first, tags are matched case-insensitively.
+	want := []string{"/dir/b.md", "/a.md"}
+	if got := refPaths(ns.NotesOfTag("GO", "")); !reflect.DeepEqual(got, want) {
+		t.Errorf("NotesOfTag() = %q, want %q", got, want)
+	}
+	if got := refPaths(ns.NotesOfCategory("dev", "")); !reflect.DeepEqual(got, want) {
+		t.Errorf("NotesOfCategory() = %q, want %q", got, want)
+	}
+
+	// Index follows notes removed from tree.
+	if err := ns.Remove("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	wantTags = []TagCount{{"Go", 1}, {"web", 1}}
+	if got := ns.Tags(""); !reflect.DeepEqual(got, wantTags) {
+		t.Errorf("Tags() after Remove() = %v, want %v", got, wantTags)
+	}
+	if got := refPaths(ns.NotesOfTag("go", "")); !reflect.DeepEqual(got, []string{"/a.md"}) {
+		t.Errorf("NotesOfTag() after Remove() = %q, want only a.md", got)
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"encoding/json"
+	"go-blog/common"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Roles of users. Admin can do everything, editor can manage notes,
+// while reader can only read notes which are not public.
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleReader = "reader"
+)
+
+// User is an account that can log in.
+type User struct {
+	Name    string
+	Hash    string // bcrypt hash of password.
+	Role    string
+	Created time.Time
+}
+
+// CheckPassword report whether password is the password of u.
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.Hash), []byte(password)) == nil
+}
+
+// SetPassword replace the password hash of u.
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.Hash = string(hash)
+	return nil
+}
+
+// IsRole report whether a role name is known.
+func IsRole(role string) bool {
+	return role == RoleAdmin || role == RoleEditor || role == RoleReader
+}
+
+// UserStore keep users. Implementations should be thread safe.
+type UserStore interface {
+	// Get return nil if there is no such user.
+	Get(name string) (*User, error)
+	// Add return ErrUserExists if there is a user with the same name.
+	Add(user *User) error
+	// Put add or replace user with the same name.
+	Put(user *User) error
+	// Update apply op to the user with name and save it, which is done atomically
+	// so that changes of others would not be lost. The user is left unchanged if op fails.
+	// It return ErrNoSuchUser if there is no such user.
+	Update(name string, op func(*User) error) error
+	// Delete return ErrNoSuchUser if there is no such user.
+	Delete(name string) error
+	// List return users sorted by name.
+	List() ([]*User, error)
+}
+
+// fileUserStore keep users in a json file.
+// The file is read again whenever it is changed, so that users modified
+// by commands take effect in a running server.
+// Writes are done with a lock file held, so that processes sharing the file
+// would not overwrite changes of each other.
+type fileUserStore struct {
+	path    string
+	users map[string]*User
+	stat  os.FileInfo // Stat of the file when last read or written, nil if it is not.
+	lock  sync.Mutex
+}
+
+// OpenFileUserStore open the user store in json file filePath.
+// The file would be created on first write.
+func OpenFileUserStore(filePath string) (UserStore, error) {
+	s := &fileUserStore{
+		path:  filePath,
+		users: make(map[string]*User),
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load read the file again if it changed since last read. It should be called with lock held.
+func (s *fileUserStore) load() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.users = make(map[string]*User)
+		s.stat = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The file is replaced by rename on every write, so that it is another file
+	// even if its size and modification time are not changed.
+	if s.stat != nil && os.SameFile(info, s.stat) &&
+		info.ModTime().Equal(s.stat.ModTime()) && info.Size() == s.stat.Size() {
+		return nil
+	}
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var users []*User
+	err = json.Unmarshal(data, &users)
+	if err != nil {
+		return err
+	}
+	s.users = make(map[string]*User, len(users))
+	for _, u := range users {
+		s.users[u.Name] = u
+	}
+	s.stat = info
+	return nil
+}
+
+// save write users to a temporary file then rename it, so that readers never see a partial file.
+// It should be called with lock held.
+func (s *fileUserStore) save() error {
+	data, err := json.MarshalIndent(s.sorted(), "", "\t")
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	// Password hashes are secret, so the file is only readable by owner.
+	err = ioutil.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpPath, s.path)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.stat = info
+	}
+	return nil
+}
+
+func (s *fileUserStore) sorted() []*User {
+	res := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		res = append(res, u)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func (s *fileUserStore) Get(name string) (*User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	u, ok := s.users[name]
+	if !ok {
+		return nil, nil
+	}
+	cp := *u
+	return &cp, nil
+}
+
+func (s *fileUserStore) Add(user *User) error {
+	return s.modify(func() error {
+		if _, ok := s.users[user.Name]; ok {
+			return &common.ErrUserExists{Name: user.Name}
+		}
+		cp := *user
+		s.users[user.Name] = &cp
+		return nil
+	})
+}
+
+func (s *fileUserStore) Put(user *User) error {
+	return s.modify(func() error {
+		cp := *user
+		s.users[user.Name] = &cp
+		return nil
+	})
+}
+
+func (s *fileUserStore) Update(name string, op func(*User) error) error {
+	return s.modify(func() error {
+		u, ok := s.users[name]
+		if !ok {
+			return &common.ErrNoSuchUser{Name: name}
+		}
+		cp := *u
+		err := op(&cp)
+		if err != nil {
+			return err
+		}
+		s.users[name] = &cp
+		return nil
+	})
+}
+
+func (s *fileUserStore) Delete(name string) error {
+	return s.modify(func() error {
+		if _, ok := s.users[name]; !ok {
+			return &common.ErrNoSuchUser{Name: name}
+		}
+		delete(s.users, name)
+		return nil
+	})
+}
+
+// modify apply op to the latest users with file locked, and save them if op succeeds.
+func (s *fileUserStore) modify(op func() error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	unlock, err := common.LockFile(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = s.load()
+	if err != nil {
+		return err
+	}
+	err = op()
+	if err != nil {
+		return err
+	}
+	err = s.save()
+	if err != nil {
+		// Users in memory are changed but not saved, read them from file next time.
+		s.stat = nil
+	}
+	return err
+}
+
+func (s *fileUserStore) List() ([]*User, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	res := s.sorted()
+	for i, u := range res {
+		cp := *u
+		res[i] = &cp
+	}
+	return res, nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"go-blog/common"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func userNames(t *testing.T, store UserStore) []string {
+	users, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res []string
+	for _, u := range users {
+		res = append(res, u.Name)
+	}
+	return res
+}
+
+func TestFileUserStore(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "users.json")
+	store, err := OpenFileUserStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err := store.Get("alice"); u != nil || err != nil {
+		t.Errorf("Get() of missing user = %v, %v, want nil", u, err)
+	}
+	for _, name := range []string{"bob", "alice"} {
+		u := &User{Name: name, Role: RoleReader}
+		if err := u.SetPassword("pw-" + name); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(filePath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("user file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	// Users changed by another store on the same file, such as commands, are read again.
+	other, err := OpenFileUserStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := other.Get("alice")
+	if err != nil || alice == nil || !alice.CheckPassword("pw-alice") || alice.CheckPassword("pw-bob") {
+		t.Fatalf("Get() = %v, %v, want alice with her password", alice, err)
+	}
+	alice.Role = RoleAdmin
+	if err := other.Put(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Delete("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("alice"); err != nil || got.Role != RoleAdmin {
+		t.Errorf("Get() after changed by another store = %v, %v, want alice as admin", got, err)
+	}
+	if names := userNames(t, store); len(names) != 1 || names[0] != "alice" {
+		t.Errorf("List() = %q, want only alice", names)
+	}
+	if _, ok := store.Delete("bob").(*common.ErrNoSuchUser); !ok {
+		t.Error("Delete() of missing user does not return *common.ErrNoSuchUser")
+	}
+}
+
+func TestFileUserStoreAdd(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "users.json")
+	stores := make([]UserStore, 2)
+	for i := range stores {
+		store, err := OpenFileUserStore(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores[i] = store
+	}
+	if err := stores[0].Add(&User{Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := stores[1].Add(&User{Name: "alice"}).(*common.ErrUserExists); !ok {
+		t.Error("Add() of existing user does not return *common.ErrUserExists")
+	}
+
+	// Stores sharing the file do not overwrite users added by each other.
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func(i int, store UserStore) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := store.Add(&User{Name: fmt.Sprintf("user-%d-%d", i, j)}); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i, store)
+	}
+	wg.Wait()
+	if names := userNames(t, stores[0]); len(names) != 21 {
+		t.Errorf("List() = %q, want alice and 20 users added concurrently", names)
+	}
+}
+
+func TestFileUserStoreUpdate(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "users.json")
+	store, err := OpenFileUserStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(&User{Name: "alice", Role: RoleReader}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := OpenFileUserStore(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Changes of another store are not lost by an update made after them.
+	if err := other.Update("alice", func(u *User) error { return u.SetPassword("secret") }); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update("alice", func(u *User) error {
+		u.Role = RoleEditor
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	alice, err := other.Get("alice")
+	if err != nil || alice.Role != RoleEditor || !alice.CheckPassword("secret") {
+		t.Errorf("Get() after updates = %v, %v, want editor with the new password", alice, err)
+	}
+
+	// A failed op leaves the user unchanged.
+	failure := errors.New("failure")
+	err = store.Update("alice", func(u *User) error {
+		u.Role = RoleAdmin
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Update() = %v, want error of op", err)
+	}
+	if alice, _ := store.Get("alice"); alice.Role != RoleEditor {
+		t.Errorf("Role after failed update = %q, want %q", alice.Role, RoleEditor)
+	}
+	if _, ok := store.Update("bob", func(*User) error { return nil }).(*common.ErrNoSuchUser); !ok {
+		t.Error("Update() of missing user does not return *common.ErrNoSuchUser")
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"go-blog/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Visibility levels of notes and directories.
+// A note or directory without its own visibility inherits the one of its parent,
+// and the root is public by default.
+const (
+	VisibilityPublic   = "public"    // Everyone can see and find it.
+	VisibilityUnlisted = "unlisted"  // Everyone with the link can see it, but it is not listed or searchable.
+	VisibilityLoggedIn = "logged-in" // Only users logged in can see it.
+	VisibilityPrivate  = "private"   // Only admins can see it.
+	VisibilityDraft    = "draft"     // Only authors, who are admins and editors, can see it.
+)
+
+// DirSettingsFile is the name of the settings file of a directory, in YAML:
+//		visibility: private
+// It is hidden so that it would not be taken as a note.
+const DirSettingsFile = ".settings.yml"
+
+// dirSettings is the content of DirSettingsFile.
+type dirSettings struct {
+	Visibility string `yaml:"visibility"`
+}
+
+var visibilityAliases = map[string]string{
+	"public":    VisibilityPublic,
+	"unlisted":  VisibilityUnlisted,
+	"hidden":    VisibilityUnlisted,
+	"logged-in": VisibilityLoggedIn,
+	"loggedin":  VisibilityLoggedIn,
+	"login":     VisibilityLoggedIn,
+	"members":   VisibilityLoggedIn,
+	"private":   VisibilityPrivate,
+	"draft":     VisibilityDraft,
+}
+
+// NormalizeVisibility return the visibility level named v, and whether v is known.
+// Empty v means to inherit and is returned as it is.
+// Unknown levels are taken as private, so that a typo would not expose a note.
+func NormalizeVisibility(v string) (string, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "" {
+		return "", true
+	}
+	if level, ok := visibilityAliases[v]; ok {
+		return level, true
+	}
+	return VisibilityPrivate, false
+}
+
+// InheritVisibility return own if it is set, otherwise parent.
+func InheritVisibility(own string, parent string) string {
+	if own != "" {
+		return own
+	}
+	return parent
+}
+
+// CanView report whether a user with role can see notes with visibility.
+// role is empty for visitors not logged in.
+func CanView(visibility string, role string) bool {
+	switch visibility {
+	case "", VisibilityPublic, VisibilityUnlisted:
+		return true
+	case VisibilityLoggedIn:
+		return role != ""
+	case VisibilityDraft:
+		return role == RoleAdmin || role == RoleEditor
+	default:
+		return role == RoleAdmin
+	}
+}
+
+// IsListed report whether notes with visibility are shown to a user with role
+// in listings and search results.
+func IsListed(visibility string, role string) bool {
+	return visibility != VisibilityUnlisted && CanView(visibility, role)
+}
+
+// OwnVisibility return the visibility set on n itself, by front matter for notes
+// or by settings file for directories. It is empty if n inherits from its parent.
+// Notes never rendered are private, since their front matter is not known,
+// such as the ones whose front matter fails to parse.
+func (n *NoteTreeNode) OwnVisibility() string {
+	if n.IsDir {
+		return n.Visibility
+	}
+	if n.RenderTime.IsZero() {
+		return VisibilityPrivate
+	}
+	return metaVisibility(n.Meta)
+}
+
+// metaVisibility return the visibility set by front matter meta, empty if it is not set.
+func metaVisibility(meta *common.FrontMatter) string {
+	if meta == nil {
+		return ""
+	}
+	if meta.Draft {
+		return VisibilityDraft
+	}
+	v, _ := NormalizeVisibility(meta.Visibility)
+	return v
+}
+
+// canLink report whether notes with visibility from can link notes with visibility to,
+// which is true if everyone who can see the former can see the latter,
+// so that links would not expose notes to users who can not see them.
+func canLink(from string, to string) bool {
+	for _, role := range []string{"", RoleReader, RoleEditor, RoleAdmin} {
+		if CanView(from, role) && !CanView(to, role) {
+			return false
+		}
+	}
+	return true
+}
+
+// effectiveVisibility return the visibility of n inherited from its ancestors.
+// It should be called with lock of tree held.
+func (n *NoteTreeNode) effectiveVisibility() string {
+	for node := n; node != nil; node = node.parent {
+		if v := node.OwnVisibility(); v != "" {
+			return v
+		}
+	}
+	return VisibilityPublic
+}
+
+// readDirVisibility return the visibility in settings file of directory n.
+func (n *NoteTreeNode) readDirVisibility() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(n.RawPath, DirSettingsFile))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return VisibilityPrivate, err
+	}
+	var settings dirSettings
+	err = yaml.Unmarshal(data, &settings)
+	if err != nil {
+		return VisibilityPrivate, err
+	}
+	v, ok := NormalizeVisibility(settings.Visibility)
+	if !ok {
+		log.Warn("Unknown visibility ", settings.Visibility, " of ", n.RawPath, ", it is taken as private.")
+	}
+	return v, nil
+}
+
+// Visibility return the visibility of the deepest node on relative path,
+// so that files other than notes get the visibility of their directory.
+func (ns *fsNoteService) Visibility(relative string) string {
+	ns.lock.RLock()
+	defer ns.lock.RUnlock()
+	node := ns.root
+	for _, entry := range strings.Split(relative, "/") {
+		if entry == "" {
+			continue
+		}
+		next, ok := node.child(entry)
+		if !ok {
+			break
+		}
+		node = next
+	}
+	return node.effectiveVisibility()
+}
+
+// listedFilter return a filter of relative paths of notes listed for role.
+// It should be called and used with lock of tree held.
+func (ns *fsNoteService) listedFilter(role string) func(relative string) bool {
+	return func(relative string) bool {
+		node := ns.root.walkTo(strings.Split(relative, "/"), 0)
+		return node != nil && IsListed(node.effectiveVisibility(), role)
+	}
+}
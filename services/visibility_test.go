@@ -0,0 +1,210 @@
+package services
+
+import (
+	"go-blog/common"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCanView(t *testing.T) {
+	roles := []string{"", RoleReader, RoleEditor, RoleAdmin}
+	tests := []struct {
+		visibility string
+		want       []bool // Whether each of roles can view.
+	}{
+		{"", []bool{true, true, true, true}},
+		{VisibilityPublic, []bool{true, true, true, true}},
+		{VisibilityUnlisted, []bool{true, true, true, true}},
+		{VisibilityLoggedIn, []bool{false, true, true, true}},
+		{VisibilityDraft, []bool{false, false, true, true}},
+		{VisibilityPrivate, []bool{false, false, false, true}},
+		{"unknown", []bool{false, false, false, true}},
+	}
+	for _, tt := range tests {
+		for i, role := range roles {
+			if got := CanView(tt.visibility, role); got != tt.want[i] {
+				t.Errorf("CanView(%q, %q) = %v, want %v", tt.visibility, role, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestIsListed(t *testing.T) {
+	if IsListed(VisibilityUnlisted, RoleAdmin) {
+		t.Error("unlisted notes are listed")
+	}
+	if !IsListed(VisibilityPublic, "") {
+		t.Error("public notes are not listed for visitors")
+	}
+	if IsListed(VisibilityPrivate, RoleEditor) {
+		t.Error("private notes are listed for editors")
+	}
+}
+
+func TestNormalizeVisibility(t *testing.T) {
+	tests := []struct {
+		v     string
+		want  string
+		known bool
+	}{
+		{"", "", true},
+		{" Public ", VisibilityPublic, true},
+		{"hidden", VisibilityUnlisted, true},
+		{"members", VisibilityLoggedIn, true},
+		{"DRAFT", VisibilityDraft, true},
+		{"secret", VisibilityPrivate, false},
+	}
+	for _, tt := range tests {
+		got, known := NormalizeVisibility(tt.v)
+		if got != tt.want || known != tt.known {
+			t.Errorf("NormalizeVisibility(%q) = %q, %v, want %q, %v", tt.v, got, known, tt.want, tt.known)
+		}
+	}
+}
+
+func TestEffectiveVisibility(t *testing.T) {
+	root := testNode(nil, ".", nil)
+	pub := testNode(root, "pub.md", nil)
+	priv := testNode(root, "priv", nil)
+	priv.Visibility = VisibilityPrivate
+	inherited := testNode(priv, "a.md", nil)
+	overridden := testNode(priv, "b.md", &common.FrontMatter{Visibility: "public"})
+	sub := testNode(priv, "sub", nil)
+	deep := testNode(sub, "c.md", nil)
+	draft := testNode(root, "d.md", &common.FrontMatter{Draft: true, Visibility: "public"})
+	members := testNode(root, "m.md", &common.FrontMatter{Visibility: "members"})
+	typo := testNode(root, "t.md", &common.FrontMatter{Visibility: "pubic"})
+	unrendered := testNode(root, "u.md", nil)
+	unrendered.RenderTime = time.Time{}
+	tests := []struct {
+		name string
+		node *NoteTreeNode
+		want string
+	}{
+		{"root is public", root, VisibilityPublic},
+		{"note without own", pub, VisibilityPublic},
+		{"directory settings", priv, VisibilityPrivate},
+		{"inherited from directory", inherited, VisibilityPrivate},
+		{"front matter overrides directory", overridden, VisibilityPublic},
+		{"inherited through directories", deep, VisibilityPrivate},
+		{"draft overrides visibility", draft, VisibilityDraft},
+		{"alias", members, VisibilityLoggedIn},
+		{"unknown is private", typo, VisibilityPrivate},
+		{"never rendered is private", unrendered, VisibilityPrivate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.node.effectiveVisibility(); got != tt.want {
+				t.Errorf("effectiveVisibility() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceVisibility(t *testing.T) {
+	root := testNode(nil, ".", nil)
+	priv := testNode(root, "priv", nil)
+	priv.Visibility = VisibilityPrivate
+	testNode(priv, "a.md", &common.FrontMatter{Visibility: "logged-in", Date: time.Now()})
+	ns := &fsNoteService{root: root}
+	tests := []struct {
+		relative string
+		want     string
+	}{
+		{"/", VisibilityPublic},
+		{"/priv", VisibilityPrivate},
+		{"/priv/a.md", VisibilityLoggedIn},
+		// Files other than notes get the visibility of their directory.
+		{"/priv/image.png", VisibilityPrivate},
+		{"/missing/a.md", VisibilityPublic},
+	}
+	for _, tt := range tests {
+		if got := ns.Visibility(tt.relative); got != tt.want {
+			t.Errorf("Visibility(%q) = %q, want %q", tt.relative, got, tt.want)
+		}
+	}
+}
+
+func TestListingsByRole(t *testing.T) {
+	ns, _, _ := newTestNotes(t, map[string]string{
+		"pub.md":                  "---\ntags: [shared]\n---\nPublic word.\n",
+		"hidden.md":               "---\ntags: [shared]\nvisibility: unlisted\n---\nHidden word.\n",
+		"members.md":              "---\ntags: [shared]\nvisibility: logged-in\n---\nMembers word.\n",
+		"priv/" + DirSettingsFile: "visibility: private\n",
+		"priv/a.md":               "---\ntags: [shared]\n---\nPrivate word.\n",
+	})
+	if err := ns.LoadFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		role string
+		want []string
+	}{
+		{"", []string{"/pub.md"}},
+		{RoleReader, []string{"/members.md", "/pub.md"}},
+		{RoleAdmin, []string{"/members.md", "/priv/a.md", "/pub.md"}},
+	}
+	for _, tt := range tests {
+		t.Run("role "+tt.role, func(t *testing.T) {
+			got := searchPaths(ns.Search("word", 0, tt.role))
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search() = %q, want %q", got, tt.want)
+			}
+			got = refPaths(ns.NotesOfTag("shared", tt.role))
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NotesOfTag() = %q, want %q", got, tt.want)
+			}
+			if tags := ns.Tags(tt.role); len(tags) != 1 || tags[0].Count != len(tt.want) {
+				t.Errorf("Tags() = %v, want shared of %d notes", tags, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestCanLink(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{VisibilityPublic, VisibilityPublic, true},
+		{VisibilityPublic, VisibilityUnlisted, true},
+		{VisibilityPublic, VisibilityLoggedIn, false},
+		{VisibilityPublic, VisibilityPrivate, false},
+		{VisibilityLoggedIn, VisibilityPublic, true},
+		{VisibilityLoggedIn, VisibilityDraft, false},
+		{VisibilityDraft, VisibilityLoggedIn, true},
+		{VisibilityDraft, VisibilityPrivate, false},
+		{VisibilityPrivate, VisibilityPrivate, true},
+		{VisibilityPrivate, VisibilityDraft, true},
+	}
+	for _, tt := range tests {
+		if got := canLink(tt.from, tt.to); got != tt.want {
+			t.Errorf("canLink(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestBrokenFrontMatterPrivate(t *testing.T) {
+	ns, _, _ := newTestNotes(t, map[string]string{
+		"good.md":   "---\ntags: [shared]\n---\nSome word.\n",
+		"broken.md": "---\ntags: [shared\n---\nSecret word.\n",
+	})
+	if err := ns.LoadFromDisk(); err == nil {
+		t.Fatal("LoadFromDisk() succeeds with broken front matter")
+	}
+	if got := ns.Visibility("/broken.md"); got != VisibilityPrivate {
+		t.Errorf("Visibility() of note failing to render = %q, want private", got)
+	}
+	refs, _ := ns.RecentNotes(0, 10, "")
+	if got := refPaths(refs); !reflect.DeepEqual(got, []string{"/good.md"}) {
+		t.Errorf("RecentNotes() = %q, want only /good.md", got)
+	}
+	if got := searchPaths(ns.Search("word", 0, "")); !reflect.DeepEqual(got, []string{"/good.md"}) {
+		t.Errorf("Search() = %q, want only /good.md", got)
+	}
+}
@@ -0,0 +1,8 @@
+// Package themes embeds the bundled themes, each of which is a directory
+// laid out like resources. They are extracted into themes directory by init.
+package themes
+
+import "embed"
+
+//go:embed */*
+var FS embed.FS